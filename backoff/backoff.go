@@ -0,0 +1,105 @@
+package backoff
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Strategy computes how long to wait before the given attempt, numbered
+// from 0, given the delay computed for the previous one (zero for the first)
+type Strategy func(attempt uint, last time.Duration) time.Duration
+
+// Constant always waits d
+func Constant(d time.Duration) Strategy {
+	return func(attempt uint, last time.Duration) time.Duration {
+		return d
+	}
+}
+
+// Linear waits base more for every attempt, starting from base,
+// up to max. A non-positive max means no limit
+func Linear(base, max time.Duration) Strategy {
+	return func(attempt uint, last time.Duration) time.Duration {
+		d := base
+		if attempt > 0 {
+			d = multiply(base, float64(attempt)+1)
+		}
+		return limit(d, max)
+	}
+}
+
+// Exponential doubles the delay for every attempt, starting from base,
+// up to max. A non-positive max means no limit
+func Exponential(base, max time.Duration) Strategy {
+	return func(attempt uint, last time.Duration) time.Duration {
+		return limit(exponential(base, attempt), max)
+	}
+}
+
+// FullJitter waits a random time between zero and the delay computed by
+// Exponential(base, max), spreading concurrent clients as much as possible
+func FullJitter(base, max time.Duration) Strategy {
+	return func(attempt uint, last time.Duration) time.Duration {
+		return between(0, limit(exponential(base, attempt), max))
+	}
+}
+
+// EqualJitter waits at least half of the delay computed by Exponential(base, max),
+// plus a random time up to the other half
+func EqualJitter(base, max time.Duration) Strategy {
+	return func(attempt uint, last time.Duration) time.Duration {
+		half := limit(exponential(base, attempt), max) / 2
+		return half + between(0, half)
+	}
+}
+
+// DecorrelatedJitter waits a random time between base and three times the
+// previous delay, up to max. A non-positive max means no limit.
+//
+// Unlike the other jittered strategies, the delay grows from the previous one
+// instead of the attempt number, which spreads concurrent clients further apart
+func DecorrelatedJitter(base, max time.Duration) Strategy {
+	return func(attempt uint, last time.Duration) time.Duration {
+		if last < base {
+			last = base
+		}
+		upper := multiply(last, 3)
+		return limit(between(base, upper), max)
+	}
+}
+
+// exponential computes base * 2^attempt without overflowing
+func exponential(base time.Duration, attempt uint) time.Duration {
+	return multiply(base, math.Pow(2, float64(attempt)))
+}
+
+// multiply computes d * f, saturating instead of overflowing
+func multiply(d time.Duration, f float64) time.Duration {
+	res := float64(d) * f
+	if res >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return time.Duration(res)
+}
+
+// limit caps d to max, unless max is non-positive
+func limit(d, max time.Duration) time.Duration {
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+// between returns a random duration in [min, max]
+func between(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	// the range includes max, unless that overflows
+	span := max - min
+	if span < math.MaxInt64 {
+		span++
+	}
+	return min + rand.N(span)
+}
@@ -0,0 +1,85 @@
+package backoff
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		attempt  uint
+		expected time.Duration
+	}{
+		{"constant first attempt", Constant(time.Second), 0, time.Second},
+		{"constant later attempt", Constant(time.Second), 10, time.Second},
+		{"linear first attempt", Linear(time.Second, 0), 0, time.Second},
+		{"linear third attempt", Linear(time.Second, 0), 2, 3 * time.Second},
+		{"linear capped", Linear(time.Second, 5*time.Second), 10, 5 * time.Second},
+		{"exponential first attempt", Exponential(time.Second, 0), 0, time.Second},
+		{"exponential fourth attempt", Exponential(time.Second, 0), 3, 8 * time.Second},
+		{"exponential capped", Exponential(time.Second, time.Minute), 10, time.Minute},
+		{"exponential does not overflow", Exponential(time.Second, 0), 200, math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := tt.strategy(tt.attempt, 0); res != tt.expected {
+				t.Errorf("Expected delay %v - got %v", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestDecorrelatedJitter(t *testing.T) {
+	base, max := 100*time.Millisecond, 5*time.Second
+	strategy := DecorrelatedJitter(base, max)
+
+	var last time.Duration
+	for attempt := uint(0); attempt < 100; attempt++ {
+		d := strategy(attempt, last)
+
+		upper := 3 * last
+		if upper < 3*base {
+			upper = 3 * base
+		}
+		if upper > max {
+			upper = max
+		}
+		if d < base || d > upper {
+			t.Errorf("Expected delay between %v and %v - got %v", base, upper, d)
+		}
+		last = d
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy Strategy
+		attempt  uint
+		min      time.Duration
+		max      time.Duration
+	}{
+		{"full jitter first attempt", FullJitter(time.Second, 0), 0, 0, time.Second},
+		{"full jitter fourth attempt", FullJitter(time.Second, 0), 3, 0, 8 * time.Second},
+		{"full jitter capped", FullJitter(time.Second, 5*time.Second), 10, 0, 5 * time.Second},
+		{"equal jitter first attempt", EqualJitter(time.Second, 0), 0, 500 * time.Millisecond, time.Second},
+		{"equal jitter fourth attempt", EqualJitter(time.Second, 0), 3, 4 * time.Second, 8 * time.Second},
+		{"equal jitter capped", EqualJitter(time.Second, 5*time.Second), 10, 2500 * time.Millisecond, 5 * time.Second},
+		{"full jitter saturated", FullJitter(time.Second, 0), 64, 0, math.MaxInt64},
+		{"equal jitter saturated", EqualJitter(time.Second, 0), 64, math.MaxInt64 / 2, math.MaxInt64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := tt.strategy(tt.attempt, 0); d < tt.min || d > tt.max {
+					t.Fatalf("Expected delay between %v and %v - got %v", tt.min, tt.max, d)
+				}
+			}
+		})
+	}
+}
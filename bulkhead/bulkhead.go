@@ -0,0 +1,85 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"patterns/clock"
+	"patterns/stability"
+)
+
+// ErrBulkheadFull is returned when a call is rejected because too many
+// calls are already in flight
+var ErrBulkheadFull = errors.New("bulkhead full")
+
+// Effector is a function interacting with a service
+type Effector[T any] = stability.Effector[T]
+
+// Bulkhead wraps an Effector function to limit the number of concurrent calls,
+// so that a slow service cannot exhaust the resources of its callers.
+//
+// At most maxConcurrent calls run at the same time; up to maxQueue more calls
+// may wait for a free slot, for at most wait (or until their context is done,
+// if wait is zero). Every other call is rejected with ErrBulkheadFull.
+//
+// It panics if maxConcurrent is zero, as no call could ever run
+func Bulkhead[T any](e Effector[T], maxConcurrent uint, maxQueue uint, wait time.Duration) Effector[T] {
+	return BulkheadWithClock(e, maxConcurrent, maxQueue, wait, clock.Real())
+}
+
+// BulkheadWithClock is like Bulkhead, but measures the waiting time using the given Clock
+func BulkheadWithClock[T any](e Effector[T], maxConcurrent uint, maxQueue uint, wait time.Duration, clk clock.Clock) Effector[T] {
+	if maxConcurrent == 0 {
+		panic("bulkhead: maxConcurrent must be positive")
+	}
+
+	// semaphore holding a token for every call in flight
+	slots := make(chan struct{}, maxConcurrent)
+	var queued atomic.Int64
+
+	acquire := func(ctx context.Context) error {
+		select {
+		case slots <- struct{}{}:
+			return nil
+		default:
+		}
+
+		// no free slot, join the queue if there is room;
+		// compared as uint64, as maxQueue may not fit in an int64
+		if uint64(queued.Add(1)) > uint64(maxQueue) {
+			queued.Add(-1)
+			return ErrBulkheadFull
+		}
+		defer queued.Add(-1)
+
+		waitCtx := ctx
+		if wait > 0 {
+			var cancel context.CancelFunc
+			waitCtx, cancel = clk.WithTimeout(ctx, wait)
+			defer cancel()
+		}
+
+		select {
+		case slots <- struct{}{}:
+			return nil
+		case <-waitCtx.Done():
+			// tells the caller giving up apart from waiting too long
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return ErrBulkheadFull
+		}
+	}
+
+	return func(ctx context.Context) (T, error) {
+		if err := acquire(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+		defer func() { <-slots }()
+
+		return e(ctx)
+	}
+}
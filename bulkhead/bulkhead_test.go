@@ -0,0 +1,160 @@
+package bulkhead
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"patterns/clock"
+)
+
+func TestBulkhead(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxConcurrent uint
+		maxQueue      uint
+		wait          time.Duration
+		// number of calls holding a slot, or waiting in the queue
+		blocked  int
+		advance  time.Duration
+		expected string
+		err      error
+	}{
+		{"free slot", 2, 0, 0, 1, 0, "OK", nil},
+		{"no free slot and no queue", 2, 0, 0, 2, 0, "", ErrBulkheadFull},
+		{"full queue", 1, 1, time.Second, 2, 0, "", ErrBulkheadFull},
+		{"waiting too long", 1, 1, time.Second, 1, time.Second, "", ErrBulkheadFull},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+			release := make(chan struct{})
+			started := make(chan struct{}, tt.blocked)
+			e := BulkheadWithClock(func(ctx context.Context) (string, error) {
+				started <- struct{}{}
+				<-release
+				return "OK", nil
+			}, tt.maxConcurrent, tt.maxQueue, tt.wait, clk)
+
+			done := make(chan struct{})
+			for i := 0; i < tt.blocked; i++ {
+				go func() {
+					e(context.Background())
+					done <- struct{}{}
+				}()
+			}
+			// wait for the blocked calls to hold their slots, or to queue
+			running := tt.blocked
+			if running > int(tt.maxConcurrent) {
+				running = int(tt.maxConcurrent)
+				clk.BlockUntil(tt.blocked - running)
+			}
+			for i := 0; i < running; i++ {
+				<-started
+			}
+
+			res := make(chan error)
+			go func() {
+				_, err := e(context.Background())
+				res <- err
+			}()
+			if tt.advance > 0 {
+				clk.BlockUntil(1)
+				clk.Advance(tt.advance)
+			}
+
+			var err error
+			if tt.err == nil {
+				// the call must not wait for the blocked ones
+				<-started
+				close(release)
+				err = <-res
+			} else {
+				err = <-res
+				close(release)
+			}
+			for i := 0; i < tt.blocked; i++ {
+				<-done
+			}
+
+			if err != tt.err {
+				t.Errorf("Expected error '%v' - got '%v'", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestBulkheadQueue(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	e := Bulkhead(func(ctx context.Context) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "OK", nil
+	}, 1, 1, 0)
+
+	go e(context.Background())
+	<-started
+
+	// the queued call runs once the slot is released
+	res := make(chan error)
+	go func() {
+		_, err := e(context.Background())
+		res <- err
+	}()
+	release <- struct{}{}
+	<-started
+	release <- struct{}{}
+
+	if err := <-res; err != nil {
+		t.Errorf("Expected no error - got '%v'", err)
+	}
+
+	// a cancelled caller leaves the queue
+	go e(context.Background())
+	<-started
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := e(ctx)
+		res <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-res; err != context.Canceled {
+		t.Errorf("Expected error '%v' - got '%v'", context.Canceled, err)
+	}
+	close(release)
+}
+
+func TestBulkheadUnboundedQueue(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	e := Bulkhead(func(ctx context.Context) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "OK", nil
+	}, 1, ^uint(0), 0)
+	defer close(release)
+
+	go e(context.Background())
+	<-started
+
+	// the largest queue must not be mistaken for no queue at all:
+	// the call joins it, then gives up as its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := e(ctx); err != context.Canceled {
+		t.Errorf("Expected error '%v' - got '%v'", context.Canceled, err)
+	}
+}
+
+func TestBulkheadZeroLimit(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a zero concurrency limit")
+		}
+	}()
+
+	Bulkhead(func(ctx context.Context) (string, error) { return "OK", nil }, 0, 1, 0)
+}
@@ -3,56 +3,594 @@ package circuitbreaker
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
-)
 
-var errServiceUnreachable error = errors.New("service unreachable")
+	"patterns/backoff"
+	"patterns/clock"
+	"patterns/stability"
+)
 
 // Circuit represents a function interacting with an upstream service;
 // it should include an error in its return list
-type Circuit func(context.Context) (string, error)
+type Circuit[T any] = stability.Effector[T]
 
-// Breaker wraps a Circuit function to provide a reset mechanism, allowing to retry
-// services call applying an exponential backoff
-func Breaker(circuit Circuit, threshold uint) Circuit {
-	var consecutiveFailures int = 0
-	var lastAttemp = time.Now()
-	var m sync.RWMutex
-
-	return func(ctx context.Context) (string, error) {
-		// read lock
-		m.RLock()
-		d := consecutiveFailures - int(threshold)
-
-		if d > 0 {
-			// exponential backoff
-			retryAt := lastAttemp.Add(time.Second * 2 << d)
-			if !time.Now().After(retryAt) {
-				m.RUnlock()
-				return "", errServiceUnreachable
+// State represents the state of a CircuitBreaker
+type State int
+
+const (
+	// StateClosed lets every call through to the Circuit
+	StateClosed State = iota
+	// StateHalfOpen lets a limited number of trial calls through
+	// to verify whether the upstream service has recovered
+	StateHalfOpen
+	// StateOpen rejects every call until the open period is over
+	StateOpen
+	// StateForcedOpen rejects every call until the override is cleared
+	StateForcedOpen
+	// StateForcedClosed lets every call through, without ever tripping,
+	// until the override is cleared
+	StateForcedClosed
+)
+
+// String returns a human readable representation of the State
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	case StateForcedOpen:
+		return "forced-open"
+	case StateForcedClosed:
+		return "forced-closed"
+	default:
+		return "unknown"
+	}
+}
+
+// Counts holds the number of calls made through a CircuitBreaker
+// since it last changed state
+type Counts struct {
+	Requests             uint
+	TotalSuccesses       uint
+	TotalFailures        uint
+	ConsecutiveSuccesses uint
+	ConsecutiveFailures  uint
+	// SlowCalls counts the calls lasting longer than the SlowCallDuration
+	SlowCalls uint
+}
+
+func (c *Counts) onRequest() {
+	c.Requests++
+}
+
+func (c *Counts) onSuccess() {
+	c.TotalSuccesses++
+	c.ConsecutiveSuccesses++
+	c.ConsecutiveFailures = 0
+}
+
+func (c *Counts) onFailure() {
+	c.TotalFailures++
+	c.ConsecutiveFailures++
+	c.ConsecutiveSuccesses = 0
+}
+
+// Status is a snapshot of the observable state of a CircuitBreaker
+type Status struct {
+	Name   string
+	State  State
+	Counts Counts
+	// RetryAt is the time at which an open breaker will allow trial calls,
+	// zero in any other state
+	RetryAt time.Time
+}
+
+// Settings configures a CircuitBreaker
+type Settings struct {
+	// Name identifies the breaker in its Status
+	Name string
+	// Threshold is the number of consecutive failures tolerated while closed:
+	// the breaker trips on the next one.
+	// Ignored when NewTripPolicy is set
+	Threshold uint
+	// Classifier decides which errors returned by the Circuit count as failures.
+	// Defaults to DefaultClassifier
+	Classifier Classifier
+	// NewTripPolicy creates the TripPolicy deciding when a closed breaker trips.
+	// Defaults to ConsecutiveFailures(Threshold + 1)
+	NewTripPolicy func() TripPolicy
+	// SlowCallDuration is the duration beyond which a call is considered slow;
+	// zero disables slow call detection. Slow trial calls always open a
+	// half-open breaker again, since the service has not recovered yet
+	SlowCallDuration time.Duration
+	// SlowCallsAsFailures makes slow calls count as failures,
+	// even when the Classifier says otherwise
+	SlowCallsAsFailures bool
+	// NewSlowCallPolicy creates a TripPolicy which is fed with slow calls
+	// instead of failures, tripping the breaker on its own: for instance
+	// CountWindow(100, 0.5, 20) trips when half of the last 100 calls were slow.
+	// Only used when SlowCallDuration is set
+	NewSlowCallPolicy func() TripPolicy
+	// Timeout is the period the breaker stays open after tripping for the first time.
+	// Defaults to 60 seconds
+	Timeout time.Duration
+	// Backoff computes the period the breaker stays open, given the number of
+	// times it tripped since it was last closed, starting from 0.
+	// Defaults to backoff.Exponential(Timeout, 10*Timeout), doubling the period
+	// every time a trial call fails and the breaker opens again, up to 10 times Timeout
+	Backoff backoff.Strategy
+	// MaxRequests is the maximum number of trial calls allowed to be in flight
+	// while half-open. Defaults to 1
+	MaxRequests uint
+	// SuccessThreshold is the number of consecutive successful trial calls
+	// needed to close the breaker again. Defaults to 1
+	SuccessThreshold uint
+	// HalfOpenTimeout is the lease on the slot taken by a trial call: once it
+	// expires, the slot is considered lost, for instance because the outcome
+	// could not be saved to the Store, and a new round of trial calls starts.
+	// Trial calls slower than HalfOpenTimeout have their outcome discarded.
+	// Defaults to 10 times Timeout
+	HalfOpenTimeout time.Duration
+	// Clock provides the current time. Defaults to clock.Real()
+	Clock clock.Clock
+	// Metrics receives the events of the breaker, identified by its Name.
+	// Defaults to discarding them
+	Metrics Metrics
+	// Store holds the state of the breaker, which is shared with every other breaker
+	// with the same Name using the same Store. Defaults to a private MemoryStore
+	Store Store
+}
+
+// CircuitBreaker is a state machine which protects an upstream service by
+// rejecting calls after too many failures, and then probing the service
+// with a limited number of trial calls before resuming normal operation
+type CircuitBreaker[T any] struct {
+	settings Settings
+	policy   TripPolicy
+	// slowPolicy is nil when slow calls cannot trip the breaker on their own
+	slowPolicy TripPolicy
+
+	m sync.Mutex
+	// r is the Record being updated while holding the lock
+	r *Record
+	// seen is the last Record loaded from the Store
+	seen      Record
+	listeners []func(from, to State)
+	fallback  Fallback[T]
+	// transitions not yet notified to the listeners
+	transitions []transition
+}
+
+// transition records a state change of a CircuitBreaker
+type transition struct {
+	from, to State
+}
+
+// NewCircuitBreaker creates a new CircuitBreaker, in the closed state,
+// configured by the given Settings
+func NewCircuitBreaker[T any](s Settings) *CircuitBreaker[T] {
+	if s.Timeout <= 0 {
+		s.Timeout = 60 * time.Second
+	}
+	if s.MaxRequests == 0 {
+		s.MaxRequests = 1
+	}
+	if s.HalfOpenTimeout <= 0 {
+		s.HalfOpenTimeout = 10 * s.Timeout
+	}
+	if s.SuccessThreshold == 0 {
+		s.SuccessThreshold = 1
+	}
+	if s.Clock == nil {
+		s.Clock = clock.Real()
+	}
+	if s.Metrics == nil {
+		s.Metrics = nopMetrics{}
+	}
+	if s.Store == nil {
+		s.Store = NewMemoryStore()
+	}
+	if s.Backoff == nil {
+		s.Backoff = backoff.Exponential(s.Timeout, 10*s.Timeout)
+	}
+	if s.Classifier == nil {
+		s.Classifier = DefaultClassifier
+	}
+	if s.NewTripPolicy == nil {
+		s.NewTripPolicy = ConsecutiveFailures(s.Threshold + 1)
+	}
+
+	cb := &CircuitBreaker[T]{settings: s, policy: s.NewTripPolicy()}
+	if s.SlowCallDuration > 0 && s.NewSlowCallPolicy != nil {
+		cb.slowPolicy = s.NewSlowCallPolicy()
+	}
+	return cb
+}
+
+// OnStateChange registers a function called on every state transition.
+//
+// Listeners are called synchronously, in registration order, by the goroutine
+// which caused the transition, after the breaker released its internal lock.
+// Transitions caused by other breakers sharing the same Store are notified
+// once this breaker observes them
+func (cb *CircuitBreaker[T]) OnStateChange(f func(from, to State)) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	cb.listeners = append(cb.listeners, f)
+}
+
+// State returns the current State of the CircuitBreaker
+func (cb *CircuitBreaker[T]) State() State {
+	return cb.Status().State
+}
+
+// Status returns a snapshot of the current state of the CircuitBreaker.
+//
+// If the Store cannot be reached, the last observed state is returned
+func (cb *CircuitBreaker[T]) Status() Status {
+	cb.m.Lock()
+	defer cb.unlock()
+
+	// on failure, seen still holds the last observed state
+	cb.update(func(now time.Time) {})
+
+	status := Status{
+		Name:   cb.settings.Name,
+		State:  cb.seen.State,
+		Counts: cb.seen.Counts,
+	}
+	if cb.seen.State == StateOpen {
+		status.RetryAt = cb.seen.OpenUntil
+	}
+	return status
+}
+
+// Trip opens the CircuitBreaker immediately, as if its TripPolicy decided so;
+// it has no effect on an open breaker or while a manual override is active
+func (cb *CircuitBreaker[T]) Trip() error {
+	cb.m.Lock()
+	defer cb.unlock()
+
+	return cb.update(func(now time.Time) {
+		if cb.r.State == StateClosed || cb.r.State == StateHalfOpen {
+			cb.setState(StateOpen, now)
+		}
+	})
+}
+
+// ForceOpen overrides the automatic state machine, rejecting every call
+// until the override is cleared by Reset
+func (cb *CircuitBreaker[T]) ForceOpen() error {
+	cb.m.Lock()
+	defer cb.unlock()
+
+	return cb.update(func(now time.Time) {
+		cb.setState(StateForcedOpen, now)
+	})
+}
+
+// ForceClosed overrides the automatic state machine, letting every call
+// through until the override is cleared by Reset
+func (cb *CircuitBreaker[T]) ForceClosed() error {
+	cb.m.Lock()
+	defer cb.unlock()
+
+	return cb.update(func(now time.Time) {
+		cb.setState(StateForcedClosed, now)
+	})
+}
+
+// Reset clears any manual override and closes the CircuitBreaker,
+// discarding its counts and the outcomes recorded by its TripPolicy
+func (cb *CircuitBreaker[T]) Reset() error {
+	cb.m.Lock()
+	defer cb.unlock()
+
+	return cb.update(func(now time.Time) {
+		cb.setState(StateClosed, now)
+	})
+}
+
+// Fallback provides a response when a call is rejected by a CircuitBreaker,
+// or fails, given the resulting error; for instance a cached value or a
+// degraded default
+type Fallback[T any] func(ctx context.Context, err error) (T, error)
+
+// SetFallback registers the Fallback invoked when a call is rejected, or its
+// error counts as a failure. Fallback outcomes never affect the breaker
+func (cb *CircuitBreaker[T]) SetFallback(f Fallback[T]) {
+	cb.m.Lock()
+	defer cb.m.Unlock()
+
+	cb.fallback = f
+}
+
+// Execute calls the given Circuit if the CircuitBreaker allows it, recording
+// its Outcome; rejected calls return an error without reaching the Circuit.
+// Rejected and failed calls are handed to the Fallback, if any.
+//
+// If the Store cannot be reached the call is not made, and the Store error is returned
+func (cb *CircuitBreaker[T]) Execute(ctx context.Context, circuit Circuit[T]) (T, error) {
+	response, failed, err := cb.execute(ctx, circuit)
+	if !failed {
+		return response, err
+	}
+
+	cb.m.Lock()
+	fallback := cb.fallback
+	cb.m.Unlock()
+
+	if fallback == nil {
+		return response, err
+	}
+	return fallback(ctx, err)
+}
+
+// execute calls the given Circuit if allowed, reporting whether the call
+// was rejected or failed, and thus should fall back
+func (cb *CircuitBreaker[T]) execute(ctx context.Context, circuit Circuit[T]) (T, bool, error) {
+	generation, err := cb.beforeCall()
+	if err != nil {
+		var zero T
+		if errors.Is(err, ErrOpenState) {
+			cb.settings.Metrics.ObserveRejection(cb.settings.Name)
+			return zero, true, err
+		}
+		return zero, false, err
+	}
+
+	// a panicking circuit still counts as a failure
+	outcome := OutcomeFailure
+	start := cb.settings.Clock.Now()
+	defer func() {
+		d := cb.settings.Clock.Now().Sub(start)
+		slow := cb.settings.SlowCallDuration > 0 && d > cb.settings.SlowCallDuration
+		if slow && outcome == OutcomeSuccess && cb.settings.SlowCallsAsFailures {
+			outcome = OutcomeFailure
+		}
+
+		cb.settings.Metrics.ObserveCall(cb.settings.Name, outcome, d)
+		cb.afterCall(generation, outcome, slow)
+	}()
+
+	response, err := circuit(ctx)
+	outcome = cb.settings.Classifier(err)
+	return response, err != nil && outcome == OutcomeFailure, err
+}
+
+// beforeCall checks whether a call is allowed in the current state,
+// returning the generation the call belongs to
+func (cb *CircuitBreaker[T]) beforeCall() (uint64, error) {
+	cb.m.Lock()
+	defer cb.unlock()
+
+	var generation uint64
+	var rejection error
+
+	err := cb.update(func(now time.Time) {
+		switch cb.r.State {
+		case StateOpen, StateForcedOpen:
+			rejection = cb.openError(now)
+			return
+		case StateHalfOpen:
+			if cb.r.HalfOpenRequests >= cb.settings.MaxRequests {
+				rejection = cb.openError(now)
+				return
+			}
+			cb.r.HalfOpenRequests++
+			cb.r.HalfOpenUntil = now.Add(cb.settings.HalfOpenTimeout)
+		}
+
+		cb.r.Counts.onRequest()
+		generation = cb.r.Generation
+	})
+	if err != nil {
+		return 0, fmt.Errorf("circuit breaker %s: %w", cb.settings.Name, err)
+	}
+
+	return generation, rejection
+}
+
+// openError builds the error returned for a call rejected at the given time
+func (cb *CircuitBreaker[T]) openError(now time.Time) *OpenError {
+	err := &OpenError{Name: cb.settings.Name, State: cb.r.State}
+	if cb.r.State == StateOpen {
+		err.Delay = cb.r.OpenUntil.Sub(now)
+	}
+	return err
+}
+
+// afterCall records the outcome of a call, unless the breaker already
+// moved to another generation while the call was in flight.
+//
+// Outcomes which cannot be saved to the Store are lost
+func (cb *CircuitBreaker[T]) afterCall(generation uint64, outcome Outcome, slow bool) {
+	cb.m.Lock()
+	defer cb.unlock()
+
+	cb.update(func(now time.Time) {
+		if generation != cb.r.Generation {
+			return
+		}
+
+		switch outcome {
+		case OutcomeSuccess:
+			cb.onSuccess(now, slow)
+		case OutcomeFailure:
+			cb.onFailure(now, slow)
+		default:
+			cb.onIgnored()
+		}
+	})
+}
+
+func (cb *CircuitBreaker[T]) onSuccess(now time.Time, slow bool) {
+	// a slow trial call shows the service has not recovered yet
+	if slow && cb.r.State == StateHalfOpen {
+		cb.onFailure(now, slow)
+		return
+	}
+
+	cb.r.Counts.onSuccess()
+	if slow {
+		cb.r.Counts.SlowCalls++
+	}
+
+	switch cb.r.State {
+	case StateClosed:
+		cb.policy.Record(now, false)
+		if cb.recordSlow(now, slow) {
+			cb.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		cb.r.HalfOpenRequests--
+		if cb.r.Counts.ConsecutiveSuccesses >= cb.settings.SuccessThreshold {
+			cb.setState(StateClosed, now)
+		}
+	}
+}
+
+func (cb *CircuitBreaker[T]) onFailure(now time.Time, slow bool) {
+	cb.r.Counts.onFailure()
+	if slow {
+		cb.r.Counts.SlowCalls++
+	}
+
+	switch cb.r.State {
+	case StateClosed:
+		cb.policy.Record(now, true)
+		// both policies must see every call
+		slowTrip := cb.recordSlow(now, slow)
+		if cb.policy.ShouldTrip(now) || slowTrip {
+			cb.setState(StateOpen, now)
+		}
+	case StateHalfOpen:
+		// a single failed trial is enough to open the breaker again
+		cb.setState(StateOpen, now)
+	}
+}
+
+// recordSlow feeds the slow call policy, if any, reporting whether it should trip
+func (cb *CircuitBreaker[T]) recordSlow(now time.Time, slow bool) bool {
+	if cb.slowPolicy == nil {
+		return false
+	}
+
+	cb.slowPolicy.Record(now, slow)
+	return cb.slowPolicy.ShouldTrip(now)
+}
+
+func (cb *CircuitBreaker[T]) onIgnored() {
+	// release the trial slot without taking a decision
+	if cb.r.State == StateHalfOpen {
+		cb.r.HalfOpenRequests--
+	}
+}
+
+// update loads the Record of the breaker from the Store and lets f modify it,
+// after catching up with the changes made by other breakers sharing the Store.
+// The lock on the breaker must be held
+func (cb *CircuitBreaker[T]) update(f func(now time.Time)) error {
+	return cb.settings.Store.Update(cb.settings.Name, func(r *Record) {
+		cb.r = r
+		defer func() {
+			cb.seen = *r
+			cb.r = nil
+		}()
+
+		// another breaker changed the state in the meantime
+		if r.Generation != cb.seen.Generation {
+			if r.State != cb.seen.State {
+				cb.transitions = append(cb.transitions, transition{from: cb.seen.State, to: r.State})
 			}
+			cb.resetPolicies()
 		}
-		//release read lock
-		m.RUnlock()
 
-		// issue request
-		response, err := circuit(ctx)
+		now := cb.settings.Clock.Now()
+		cb.refresh(now)
+		f(now)
+	})
+}
 
-		// lock on lastAttempt
-		m.Lock()
-		defer m.Unlock()
+// refresh moves an open breaker to half-open once its open period is over,
+// and starts a new round of trial calls once the slots of the current one lapse
+func (cb *CircuitBreaker[T]) refresh(now time.Time) {
+	switch cb.r.State {
+	case StateOpen:
+		if !now.Before(cb.r.OpenUntil) {
+			cb.setState(StateHalfOpen, now)
+		}
+	case StateHalfOpen:
+		// the new generation discards the outcomes of calls reporting back late
+		if cb.r.HalfOpenRequests > 0 && !now.Before(cb.r.HalfOpenUntil) {
+			cb.setState(StateHalfOpen, now)
+		}
+	}
+}
 
-		lastAttemp = time.Now()
+// setState moves the breaker to a new generation in the given state
+func (cb *CircuitBreaker[T]) setState(state State, now time.Time) {
+	if state != cb.r.State {
+		cb.transitions = append(cb.transitions, transition{from: cb.r.State, to: state})
+	}
+
+	cb.r.State = state
+	cb.r.Generation++
+	cb.r.Counts = Counts{}
+	cb.r.HalfOpenRequests = 0
+	cb.r.HalfOpenUntil = time.Time{}
+
+	switch state {
+	case StateClosed:
+		cb.r.Trips = 0
+		cb.r.OpenPeriod = 0
+		// outcomes recorded before tripping say nothing about the recovered service
+		cb.resetPolicies()
+	case StateOpen:
+		cb.r.OpenPeriod = cb.settings.Backoff(cb.r.Trips, cb.r.OpenPeriod)
+		cb.r.OpenUntil = now.Add(cb.r.OpenPeriod)
+		cb.r.Trips++
+	}
+}
 
-		// service call failed
-		if err != nil {
-			consecutiveFailures++
-			return response, err
+func (cb *CircuitBreaker[T]) resetPolicies() {
+	cb.policy.Reset()
+	if cb.slowPolicy != nil {
+		cb.slowPolicy.Reset()
+	}
+}
+
+// unlock releases the lock on the breaker, then notifies the listeners
+// of the transitions which happened while holding it
+func (cb *CircuitBreaker[T]) unlock() {
+	transitions := cb.transitions
+	listeners := cb.listeners
+	cb.transitions = nil
+	cb.m.Unlock()
+
+	for _, t := range transitions {
+		cb.settings.Metrics.ObserveTransition(cb.settings.Name, t.from, t.to)
+		for _, f := range listeners {
+			f(t.from, t.to)
 		}
+	}
+}
+
+// Breaker wraps a Circuit function to provide a reset mechanism, allowing to retry
+// services call applying an exponential backoff, capped at 10 minutes
+func Breaker[T any](circuit Circuit[T], threshold uint) Circuit[T] {
+	cb := NewCircuitBreaker[T](Settings{
+		Threshold: threshold,
+		Backoff:   backoff.Exponential(time.Second*4, time.Minute*10),
+	})
 
-		// service call successfull, reset counter
-		consecutiveFailures = 0
-		return response, nil
+	return func(ctx context.Context) (T, error) {
+		return cb.Execute(ctx, circuit)
 	}
 }
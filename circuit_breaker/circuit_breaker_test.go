@@ -3,8 +3,12 @@ package circuitbreaker
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 	"time"
+
+	"patterns/backoff"
+	"patterns/clock"
 )
 
 var errFailedService error = errors.New("something went wrong")
@@ -27,10 +31,10 @@ func TestBreaker(t *testing.T) {
 	}{
 		{"working circuit", 0, "OK", nil},
 		{"broken circuit - 2s backoff", 0, "", errFailedService},
-		{"call after 1st fail", 1, "", errServiceUnreachable},
+		{"call after 1st fail", 1, "", ErrOpenState},
 		{"another failed service call - 4s backoff", 3, "", errFailedService},
-		{"immediate call after 2nd fail", 1, "", errServiceUnreachable},
-		{"still in 2nd fail backoff", 3, "", errServiceUnreachable},
+		{"immediate call after 2nd fail", 1, "", ErrOpenState},
+		{"still in 2nd fail backoff", 3, "", ErrOpenState},
 		{"service back up after 2nd fail", 5, "OK", nil},
 	}
 
@@ -45,7 +49,7 @@ func TestBreaker(t *testing.T) {
 				if tt.err == nil {
 					t.Errorf("Expected no error - got %v", err)
 				}
-				if tt.err != err {
+				if !errors.Is(err, tt.err) {
 					t.Errorf("Expected error %v - got %v", tt.err, err)
 				}
 			} else {
@@ -59,3 +63,369 @@ func TestBreaker(t *testing.T) {
 		})
 	}
 }
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	cb := NewCircuitBreaker[string](Settings{
+		Threshold:        1,
+		Timeout:          100 * time.Millisecond,
+		MaxRequests:      1,
+		SuccessThreshold: 2,
+	})
+	ctx := context.Background()
+
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+	working := func(ctx context.Context) (string, error) { return "OK", nil }
+
+	for i := 0; i < 2; i++ {
+		if _, err := cb.Execute(ctx, failing); err != errFailedService {
+			t.Fatalf("Expected error %v - got %v", errFailedService, err)
+		}
+	}
+	_, err := cb.Execute(ctx, working)
+	var openErr *OpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("Expected open breaker to return an *OpenError - got %v", err)
+	}
+	if openErr.State != StateOpen || openErr.RetryAfter() <= 0 || openErr.RetryAfter() > 100*time.Millisecond {
+		t.Errorf("Expected open state with a retry delay up to 100ms - got %+v", openErr)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	// the first trial call holds the only half-open slot
+	release := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		_, err := cb.Execute(ctx, func(ctx context.Context) (string, error) {
+			close(started)
+			<-release
+			return "OK", nil
+		})
+		done <- err
+	}()
+	<-started
+
+	if _, err := cb.Execute(ctx, working); !errors.Is(err, ErrOpenState) {
+		t.Errorf("Expected concurrent trial call to be rejected - got %v", err)
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("Expected no error from trial call - got %v", err)
+	}
+
+	// a second success is needed to close the breaker
+	if _, err := cb.Execute(ctx, working); err != nil {
+		t.Errorf("Expected no error from second trial call - got %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := cb.Execute(ctx, working); err != nil {
+			t.Errorf("Expected closed breaker to allow calls - got %v", err)
+		}
+	}
+}
+
+func TestCircuitBreakerStatus(t *testing.T) {
+	cb := NewCircuitBreaker[string](Settings{
+		Name:      "upstream",
+		Threshold: 1,
+		Timeout:   100 * time.Millisecond,
+	})
+	ctx := context.Background()
+
+	var transitions []string
+	cb.OnStateChange(func(from, to State) {
+		transitions = append(transitions, from.String()+" -> "+to.String())
+	})
+
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+	working := func(ctx context.Context) (string, error) { return "OK", nil }
+
+	cb.Execute(ctx, failing)
+	status := cb.Status()
+	if status.Name != "upstream" || status.State != StateClosed {
+		t.Errorf("Expected closed breaker named upstream - got %+v", status)
+	}
+	if status.Counts.ConsecutiveFailures != 1 || status.Counts.Requests != 1 {
+		t.Errorf("Expected 1 request and 1 consecutive failure - got %+v", status.Counts)
+	}
+
+	before := time.Now()
+	cb.Execute(ctx, failing)
+	status = cb.Status()
+	if status.State != StateOpen {
+		t.Errorf("Expected breaker to be %s - got %s", StateOpen, status.State)
+	}
+	if status.RetryAt.Before(before.Add(100 * time.Millisecond)) {
+		t.Errorf("Expected retry time after %v - got %v", before.Add(100*time.Millisecond), status.RetryAt)
+	}
+
+	_, err := cb.Execute(ctx, working)
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || openErr.Name != "upstream" {
+		t.Errorf("Expected an *OpenError from breaker upstream - got %v", err)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if state := cb.State(); state != StateHalfOpen {
+		t.Errorf("Expected breaker to be %s - got %s", StateHalfOpen, state)
+	}
+
+	cb.Execute(ctx, working)
+	if state := cb.State(); state != StateClosed {
+		t.Errorf("Expected breaker to be %s - got %s", StateClosed, state)
+	}
+
+	expected := []string{"closed -> open", "open -> half-open", "half-open -> closed"}
+	if len(transitions) != len(expected) {
+		t.Fatalf("Expected transitions %v - got %v", expected, transitions)
+	}
+	for i := range expected {
+		if transitions[i] != expected[i] {
+			t.Errorf("Expected transition %s - got %s", expected[i], transitions[i])
+		}
+	}
+}
+
+func TestCircuitBreakerClassifier(t *testing.T) {
+	errBadRequest := errors.New("bad request")
+
+	tests := []struct {
+		name       string
+		classifier Classifier
+		err        error
+		expected   State
+	}{
+		{"failures trip the breaker", nil, errFailedService, StateOpen},
+		{"caller cancellation is ignored by default", nil, context.Canceled, StateClosed},
+		{"wrapped cancellation is ignored by default", nil, fmt.Errorf("call: %w", context.Canceled), StateClosed},
+		{"ignored errors", IgnoreErrors(errBadRequest), errBadRequest, StateClosed},
+		{"other errors still trip with ignored errors", IgnoreErrors(errBadRequest), errFailedService, StateOpen},
+		{"errors counted as successes", func(err error) Outcome { return OutcomeSuccess }, errFailedService, StateClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := NewCircuitBreaker[string](Settings{Threshold: 2, Classifier: tt.classifier})
+
+			for i := 0; i < 3; i++ {
+				cb.Execute(context.Background(), func(ctx context.Context) (string, error) {
+					return "", tt.err
+				})
+			}
+
+			if state := cb.State(); state != tt.expected {
+				t.Errorf("Expected breaker to be %s - got %s", tt.expected, state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerOverrides(t *testing.T) {
+	cb := NewCircuitBreaker[string](Settings{Threshold: 0, Timeout: time.Millisecond})
+	ctx := context.Background()
+
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+	working := func(ctx context.Context) (string, error) { return "OK", nil }
+
+	cb.ForceOpen()
+	time.Sleep(2 * time.Millisecond)
+	if _, err := cb.Execute(ctx, working); !errors.Is(err, ErrOpenState) {
+		t.Errorf("Expected forced open breaker to return %v - got %v", ErrOpenState, err)
+	}
+	cb.Trip()
+	if state := cb.State(); state != StateForcedOpen {
+		t.Errorf("Expected breaker to be %s - got %s", StateForcedOpen, state)
+	}
+
+	cb.ForceClosed()
+	for i := 0; i < 3; i++ {
+		if _, err := cb.Execute(ctx, failing); err != errFailedService {
+			t.Errorf("Expected forced closed breaker to return %v - got %v", errFailedService, err)
+		}
+	}
+	if status := cb.Status(); status.State != StateForcedClosed || status.Counts.TotalFailures != 3 {
+		t.Errorf("Expected breaker to be %s with 3 failures - got %+v", StateForcedClosed, status)
+	}
+
+	cb.Reset()
+	cb.Execute(ctx, failing)
+	if state := cb.State(); state != StateOpen {
+		t.Errorf("Expected breaker to trip after Reset() - got %s", state)
+	}
+}
+
+func TestCircuitBreakerBackoff(t *testing.T) {
+	var attempts []uint
+	cb := NewCircuitBreaker[string](Settings{
+		Threshold: 0,
+		Backoff: func(attempt uint, last time.Duration) time.Duration {
+			attempts = append(attempts, attempt)
+			return backoff.Constant(50*time.Millisecond)(attempt, last)
+		},
+	})
+	ctx := context.Background()
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+
+	for i := 0; i < 3; i++ {
+		cb.Execute(ctx, failing)
+		if delay := time.Until(cb.Status().RetryAt); delay > 50*time.Millisecond {
+			t.Errorf("Expected open period up to 50ms - got %v", delay)
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	if len(attempts) != 3 || attempts[0] != 0 || attempts[2] != 2 {
+		t.Errorf("Expected backoff attempts [0 1 2] - got %v", attempts)
+	}
+}
+
+func TestCircuitBreakerFakeClock(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+	cb := NewCircuitBreaker[string](Settings{
+		Threshold: 0,
+		Backoff:   backoff.Exponential(time.Minute, 0),
+		Clock:     clk,
+	})
+	ctx := context.Background()
+
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+	working := func(ctx context.Context) (string, error) { return "OK", nil }
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		circuit Circuit[string]
+		err     error
+		state   State
+	}{
+		{"first failure trips", 0, failing, errFailedService, StateOpen},
+		{"rejected before the open period ends", 59 * time.Second, working, ErrOpenState, StateOpen},
+		{"failed trial call doubles the open period", time.Second, failing, errFailedService, StateOpen},
+		{"still open after the first period", time.Minute, working, ErrOpenState, StateOpen},
+		{"successful trial call closes", time.Minute, working, nil, StateClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.advance)
+			_, err := cb.Execute(ctx, tt.circuit)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected error %v - got %v", tt.err, err)
+			}
+			if state := cb.State(); state != tt.state {
+				t.Errorf("Expected breaker to be %s - got %s", tt.state, state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerDefaultBackoff(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	cb := NewCircuitBreaker[string](Settings{Threshold: 0, Timeout: time.Minute, Clock: clk})
+	ctx := context.Background()
+
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+	working := func(ctx context.Context) (string, error) { return "OK", nil }
+
+	cb.Execute(ctx, failing)
+	for range 8 {
+		clk.Advance(10 * time.Minute)
+		if _, err := cb.Execute(ctx, failing); !errors.Is(err, errFailedService) {
+			t.Fatalf("Expected error %v - got %v", errFailedService, err)
+		}
+	}
+
+	// the open period stops growing at 10 times Timeout
+	var openErr *OpenError
+	if _, err := cb.Execute(ctx, working); !errors.As(err, &openErr) || openErr.RetryAfter() != 10*time.Minute {
+		t.Errorf("Expected a %v open period - got %v", 10*time.Minute, err)
+	}
+}
+
+func TestCircuitBreakerSlowCalls(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings Settings
+		calls    int
+		expected State
+	}{
+		{"slow call detection disabled", Settings{Threshold: 1}, 5, StateClosed},
+		{"slow calls as failures", Settings{Threshold: 1, SlowCallDuration: time.Second, SlowCallsAsFailures: true}, 2, StateOpen},
+		{"slow call rate below min calls", Settings{SlowCallDuration: time.Second, NewSlowCallPolicy: CountWindow(10, 0.5, 5)}, 4, StateClosed},
+		{"slow call rate reached", Settings{SlowCallDuration: time.Second, NewSlowCallPolicy: CountWindow(10, 0.5, 5)}, 5, StateOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+			tt.settings.Clock = clk
+			cb := NewCircuitBreaker[string](tt.settings)
+
+			slow := func(ctx context.Context) (string, error) {
+				clk.Advance(2 * time.Second)
+				return "OK", nil
+			}
+			for i := 0; i < tt.calls; i++ {
+				cb.Execute(context.Background(), slow)
+			}
+
+			if state := cb.State(); state != tt.expected {
+				t.Errorf("Expected breaker to be %s - got %s", tt.expected, state)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerFallback(t *testing.T) {
+	collector := NewCollector()
+	cb := NewCircuitBreaker[string](Settings{Name: "upstream", Threshold: 1, Timeout: time.Minute, Metrics: collector})
+	ctx := context.Background()
+
+	var fallbackErrs []error
+	cb.SetFallback(func(ctx context.Context, err error) (string, error) {
+		fallbackErrs = append(fallbackErrs, err)
+		return "cached", nil
+	})
+
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+	cancelled := func(ctx context.Context) (string, error) { return "", context.Canceled }
+
+	tests := []struct {
+		name     string
+		circuit  Circuit[string]
+		expected string
+		err      error
+	}{
+		{"ignored errors do not fall back", cancelled, "", context.Canceled},
+		{"failure falls back", failing, "cached", nil},
+		{"tripping failure falls back", failing, "cached", nil},
+		{"rejection falls back", failing, "cached", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := cb.Execute(ctx, tt.circuit)
+			if err != tt.err {
+				t.Errorf("Expected error %v - got %v", tt.err, err)
+			} else if res != tt.expected {
+				t.Errorf("Expected %s - got %s", tt.expected, res)
+			}
+		})
+	}
+
+	if len(fallbackErrs) != 3 || fallbackErrs[0] != errFailedService || !errors.Is(fallbackErrs[2], ErrOpenState) {
+		t.Errorf("Expected fallback to receive 2 failures and a rejection - got %v", fallbackErrs)
+	}
+
+	// fallback results are not recorded as successes
+	m := collector.Snapshot()["upstream"]
+	if m.Calls[OutcomeSuccess] != 0 || m.Calls[OutcomeFailure] != 2 || m.Rejections != 1 {
+		t.Errorf("Expected 2 failures and 1 rejection - got %v and %d", m.Calls, m.Rejections)
+	}
+	if state := cb.State(); state != StateOpen {
+		t.Errorf("Expected breaker to be %s - got %s", StateOpen, state)
+	}
+}
@@ -0,0 +1,62 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+)
+
+// Outcome describes how the result of a call affects a CircuitBreaker
+type Outcome int
+
+const (
+	// OutcomeSuccess counts the call as a success
+	OutcomeSuccess Outcome = iota
+	// OutcomeFailure counts the call as a failure, possibly tripping the breaker
+	OutcomeFailure
+	// OutcomeIgnored leaves the breaker untouched, as if the call never happened
+	OutcomeIgnored
+)
+
+// String returns a human readable representation of the Outcome
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeFailure:
+		return "failure"
+	case OutcomeIgnored:
+		return "ignored"
+	default:
+		return "unknown"
+	}
+}
+
+// Classifier decides the Outcome of a call given the error returned by the Circuit
+type Classifier func(err error) Outcome
+
+// DefaultClassifier counts nil errors as successes and every other error as
+// a failure, except for context.Canceled: a caller giving up on a call says
+// nothing about the health of the upstream service
+func DefaultClassifier(err error) Outcome {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, context.Canceled):
+		return OutcomeIgnored
+	default:
+		return OutcomeFailure
+	}
+}
+
+// IgnoreErrors returns a Classifier which behaves like DefaultClassifier,
+// except that errors matching any of the given targets are ignored
+func IgnoreErrors(targets ...error) Classifier {
+	return func(err error) Outcome {
+		for _, target := range targets {
+			if errors.Is(err, target) {
+				return OutcomeIgnored
+			}
+		}
+		return DefaultClassifier(err)
+	}
+}
@@ -0,0 +1,52 @@
+package circuitbreaker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOpenState is matched, through errors.Is, by every error returned
+// when a CircuitBreaker rejects a call
+var ErrOpenState = errors.New("circuit breaker is open")
+
+// ErrUnknownBreaker is returned when operating on a Registry breaker
+// which was never created
+var ErrUnknownBreaker = errors.New("unknown circuit breaker")
+
+// OpenError is returned when a CircuitBreaker rejects a call, either
+// because it is open, forced open, or because all of its half-open
+// trial slots are taken
+type OpenError struct {
+	// Name of the breaker which rejected the call
+	Name string
+	// State of the breaker when the call was rejected
+	State State
+	// Delay is the time left before the breaker allows trial calls;
+	// zero when rejected while half-open or forced open
+	Delay time.Duration
+}
+
+func (e *OpenError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = "circuit breaker"
+	}
+	switch e.State {
+	case StateHalfOpen:
+		return fmt.Sprintf("%s is half-open: too many trial calls", name)
+	case StateForcedOpen:
+		return fmt.Sprintf("%s is forced open", name)
+	}
+	return fmt.Sprintf("%s is open: retry in %v", name, e.Delay)
+}
+
+// Unwrap allows matching an OpenError against ErrOpenState
+func (e *OpenError) Unwrap() error {
+	return ErrOpenState
+}
+
+// RetryAfter returns how long callers should wait before trying again
+func (e *OpenError) RetryAfter() time.Duration {
+	return e.Delay
+}
@@ -0,0 +1,76 @@
+package circuitbreaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// FileStore is a Store keeping each Record in a JSON file, which can be shared
+// by breakers living in different processes on the same host.
+//
+// Concurrent updates are serialized through advisory file locks, which
+// are only available on unix systems
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore keeping its files in the given directory,
+// creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Update atomically updates the Record with the given name, holding
+// an exclusive lock on its file
+func (s *FileStore) Update(name string, f func(r *Record)) (err error) {
+	file, err := os.OpenFile(s.path(name), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	if err := lockFile(file); err != nil {
+		return err
+	}
+	defer unlockFile(file)
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	var r Record
+	// a freshly created file holds a zero Record
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("corrupted record %s: %w", file.Name(), err)
+		}
+	}
+
+	f(&r)
+
+	if data, err = json.Marshal(r); err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	return err
+}
+
+// path returns the path of the file holding the Record with the given name
+func (s *FileStore) path(name string) string {
+	return filepath.Join(s.dir, url.PathEscape(name)+".json")
+}
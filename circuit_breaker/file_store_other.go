@@ -0,0 +1,16 @@
+//go:build !unix
+
+package circuitbreaker
+
+import (
+	"errors"
+	"os"
+)
+
+func lockFile(f *os.File) error {
+	return errors.ErrUnsupported
+}
+
+func unlockFile(f *os.File) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,134 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// StatusError reports a response with a server error status to a CircuitBreaker,
+// so that it counts as a failure unless ignored by Settings.Classifier
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Transport is an http.RoundTripper protecting every host with its own
+// CircuitBreaker, taken from a Registry by the host name.
+//
+// Responses with a 5xx status are reported to the breaker as a StatusError,
+// and returned as they are unless the breaker has a Fallback, whose response
+// replaces them; requests rejected by an open breaker fail with an OpenError,
+// unless the Fallback returns a response
+type Transport struct {
+	base     http.RoundTripper
+	registry *Registry[*http.Response]
+}
+
+// NewTransport creates a Transport sending requests through base, or http.DefaultTransport if nil,
+// and taking the breakers from the given Registry
+func NewTransport(base http.RoundTripper, registry *Registry[*http.Response]) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base, registry: registry}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cb := t.registry.Get(req.URL.Host)
+
+	sent := false
+	var served *http.Response
+	resp, err := cb.Execute(req.Context(), func(ctx context.Context) (*http.Response, error) {
+		sent = true
+		resp, err := t.base.RoundTrip(req)
+		if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+			served = resp
+			return resp, &StatusError{StatusCode: resp.StatusCode}
+		}
+		return resp, err
+	})
+
+	// the RoundTripper owns the request body, even when not sending it
+	if !sent && req.Body != nil {
+		req.Body.Close()
+	}
+	// a response replaced by the Fallback would leak its connection
+	if served != nil && served != resp {
+		served.Body.Close()
+	}
+
+	var status *StatusError
+	if resp != nil && errors.As(err, &status) {
+		return resp, nil
+	}
+	// a Fallback may return neither, which http.Client does not accept
+	if resp == nil && err == nil {
+		return nil, fmt.Errorf("%s: fallback returned no response", cb.settings.Name)
+	}
+	return resp, err
+}
+
+// Handler wraps an http.Handler to protect it with the given CircuitBreaker.
+//
+// Responses with a 5xx status count as failures. While the breaker is open,
+// requests get a 503 Service Unavailable response, with a Retry-After header
+// when the time left before the breaker allows trial calls is known
+func Handler[T any](cb *CircuitBreaker[T], next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served := false
+		_, err := cb.Execute(r.Context(), func(ctx context.Context) (T, error) {
+			served = true
+			rec := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			var zero T
+			if rec.status >= http.StatusInternalServerError {
+				return zero, &StatusError{StatusCode: rec.status}
+			}
+			return zero, nil
+		})
+		if served {
+			return
+		}
+
+		var open *OpenError
+		if errors.As(err, &open) && open.RetryAfter() > 0 {
+			// Retry-After is given in whole seconds
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(open.RetryAfter().Seconds()))))
+		}
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+	})
+}
+
+// statusRecorder records the status code written by a Handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the original ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,189 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"patterns/clock"
+)
+
+func TestTransport(t *testing.T) {
+	var failing, working atomic.Int32
+	failingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		failing.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failingSrv.Close()
+	workingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		working.Add(1)
+	}))
+	defer workingSrv.Close()
+
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	r := NewRegistry[*http.Response](Settings{Threshold: 1, Timeout: time.Minute, Clock: clk})
+	client := &http.Client{Transport: NewTransport(nil, r)}
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		err    error
+	}{
+		{"first failure", failingSrv.URL, http.StatusBadGateway, nil},
+		{"second failure trips the breaker", failingSrv.URL, http.StatusBadGateway, nil},
+		{"open breaker", failingSrv.URL, 0, ErrOpenState},
+		{"other hosts have their own breaker", workingSrv.URL, http.StatusOK, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.Get(tt.url)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expected error '%v' - got '%v'", tt.err, err)
+			}
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("Expected status %d - got %d", tt.status, resp.StatusCode)
+			}
+		})
+	}
+
+	if n := failing.Load(); n != 2 {
+		t.Errorf("Expected 2 requests to the failing host - got %d", n)
+	}
+	if n := working.Load(); n != 1 {
+		t.Errorf("Expected 1 request to the working host - got %d", n)
+	}
+	if state := r.Get(workingSrv.Listener.Addr().String()).State(); state != StateClosed {
+		t.Errorf("Expected breaker to be %s - got %s", StateClosed, state)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	cb := NewCircuitBreaker[struct{}](Settings{Timeout: time.Minute, Clock: clk})
+
+	var written int
+	h := Handler(cb, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(written)
+	}))
+
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		written    int
+		status     int
+		retryAfter string
+	}{
+		{"failure trips the breaker", 0, http.StatusInternalServerError, http.StatusInternalServerError, ""},
+		{"open breaker", 0, http.StatusOK, http.StatusServiceUnavailable, "60"},
+		{"retry after rounds up", 500 * time.Millisecond, http.StatusOK, http.StatusServiceUnavailable, "60"},
+		{"trial call closes the breaker", time.Minute, http.StatusOK, http.StatusOK, ""},
+		{"client errors are not failures", 0, http.StatusNotFound, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.advance)
+			written = tt.written
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d - got %d", tt.status, w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Expected Retry-After '%s' - got '%s'", tt.retryAfter, got)
+			}
+		})
+	}
+
+	if state := cb.State(); state != StateClosed {
+		t.Errorf("Expected breaker to be %s - got %s", StateClosed, state)
+	}
+}
+
+func TestTransportFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	r := NewRegistry[*http.Response](Settings{})
+	transport := NewTransport(nil, r)
+
+	host := srv.Listener.Addr().String()
+	r.Get(host).SetFallback(func(ctx context.Context, err error) (*http.Response, error) {
+		return nil, nil
+	})
+	if err := r.ForceOpen(host); err != nil {
+		t.Fatalf("Expected no error - got %v", err)
+	}
+
+	// RoundTrip must return either a response or an error
+	req := httptest.NewRequest(http.MethodGet, srv.URL, nil)
+	if resp, err := transport.RoundTrip(req); resp == nil && err == nil {
+		t.Error("Expected an error for a fallback without response - got none")
+	}
+}
+
+// closeTracker records whether the body of the responses it gets was closed
+type closeTracker struct {
+	closed atomic.Bool
+}
+
+func (c *closeTracker) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = &trackedBody{ReadCloser: resp.Body, closed: &c.closed}
+	return resp, nil
+}
+
+type trackedBody struct {
+	io.ReadCloser
+	closed *atomic.Bool
+}
+
+func (b *trackedBody) Close() error {
+	b.closed.Store(true)
+	return b.ReadCloser.Close()
+}
+
+func TestTransportFallbackClosesBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	r := NewRegistry[*http.Response](Settings{})
+	tracker := &closeTracker{}
+	client := &http.Client{Transport: NewTransport(tracker, r)}
+
+	r.Get(srv.Listener.Addr().String()).SetFallback(func(ctx context.Context, err error) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}, nil
+	})
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected no error - got %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d - got %d", http.StatusOK, resp.StatusCode)
+	}
+	if !tracker.closed.Load() {
+		t.Error("Expected the body of the replaced response to be closed")
+	}
+}
@@ -0,0 +1,160 @@
+package circuitbreaker
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Metrics receives the events of the CircuitBreakers reporting to it,
+// identified by their name. Implementations must be thread safe
+type Metrics interface {
+	// ObserveCall reports a call which reached the Circuit, with its Outcome and duration
+	ObserveCall(name string, outcome Outcome, d time.Duration)
+	// ObserveRejection reports a call rejected by the breaker
+	ObserveRejection(name string)
+	// ObserveTransition reports a state transition
+	ObserveTransition(name string, from, to State)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveCall(name string, outcome Outcome, d time.Duration) {}
+func (nopMetrics) ObserveRejection(name string)                              {}
+func (nopMetrics) ObserveTransition(name string, from, to State)             {}
+
+// DefaultBuckets are the upper bounds of the latency histograms
+// used by a Collector when none are given
+var DefaultBuckets = []time.Duration{
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Histogram counts observed durations in buckets
+type Histogram struct {
+	// Buckets holds the upper bounds of the buckets, in increasing order
+	Buckets []time.Duration
+	// Counts holds the number of observations falling in each bucket,
+	// plus one more for those exceeding the last bound
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	i := sort.Search(len(h.Buckets), func(i int) bool {
+		return d <= h.Buckets[i]
+	})
+	h.Counts[i]++
+	h.Count++
+	h.Sum += d
+}
+
+// BreakerMetrics holds the metrics collected for a single breaker
+type BreakerMetrics struct {
+	// State is the last state the breaker transitioned to
+	State State
+	// Calls counts the calls which reached the Circuit, by Outcome
+	Calls      map[Outcome]uint64
+	Rejections uint64
+	// Transitions counts the transitions, by target State
+	Transitions map[State]uint64
+	Latency     Histogram
+}
+
+// Collector is a Metrics implementation keeping every metric in memory
+type Collector struct {
+	buckets []time.Duration
+
+	m        sync.Mutex
+	breakers map[string]*BreakerMetrics
+}
+
+// NewCollector creates a Collector whose latency histograms use the given
+// bucket bounds, or DefaultBuckets if none are given
+func NewCollector(buckets ...time.Duration) *Collector {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]time.Duration(nil), buckets...)
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i] < buckets[j] })
+
+	return &Collector{buckets: buckets, breakers: make(map[string]*BreakerMetrics)}
+}
+
+// ObserveCall counts a call and records its duration
+func (c *Collector) ObserveCall(name string, outcome Outcome, d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	b := c.breaker(name)
+	b.Calls[outcome]++
+	b.Latency.observe(d)
+}
+
+// ObserveRejection counts a rejected call
+func (c *Collector) ObserveRejection(name string) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.breaker(name).Rejections++
+}
+
+// ObserveTransition counts a state transition
+func (c *Collector) ObserveTransition(name string, from, to State) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	b := c.breaker(name)
+	b.State = to
+	b.Transitions[to]++
+}
+
+// Snapshot returns a copy of the metrics collected so far, by breaker name
+func (c *Collector) Snapshot() map[string]BreakerMetrics {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	snapshot := make(map[string]BreakerMetrics, len(c.breakers))
+	for name, b := range c.breakers {
+		copied := *b
+		copied.Calls = make(map[Outcome]uint64, len(b.Calls))
+		for k, v := range b.Calls {
+			copied.Calls[k] = v
+		}
+		copied.Transitions = make(map[State]uint64, len(b.Transitions))
+		for k, v := range b.Transitions {
+			copied.Transitions[k] = v
+		}
+		copied.Latency.Counts = append([]uint64(nil), b.Latency.Counts...)
+		snapshot[name] = copied
+	}
+	return snapshot
+}
+
+// breaker returns the metrics of the breaker with the given name,
+// creating them if needed. The lock must be held
+func (c *Collector) breaker(name string) *BreakerMetrics {
+	b, ok := c.breakers[name]
+	if !ok {
+		b = &BreakerMetrics{
+			Calls:       make(map[Outcome]uint64),
+			Transitions: make(map[State]uint64),
+			Latency: Histogram{
+				Buckets: c.buckets,
+				Counts:  make([]uint64, len(c.buckets)+1),
+			},
+		}
+		c.breakers[name] = b
+	}
+	return b
+}
@@ -0,0 +1,82 @@
+package circuitbreaker
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"patterns/clock"
+)
+
+func TestCollector(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	collector := NewCollector(10*time.Millisecond, 100*time.Millisecond)
+	cb := NewCircuitBreaker[string](Settings{
+		Name:      "upstream",
+		Threshold: 1,
+		Clock:     clk,
+		Metrics:   collector,
+	})
+	ctx := context.Background()
+
+	slow := func(ctx context.Context) (string, error) {
+		clk.Advance(50 * time.Millisecond)
+		return "OK", nil
+	}
+	failing := func(ctx context.Context) (string, error) {
+		clk.Advance(500 * time.Millisecond)
+		return "", errFailedService
+	}
+
+	cb.Execute(ctx, slow)
+	cb.Execute(ctx, failing)
+	cb.Execute(ctx, failing)
+	cb.Execute(ctx, slow)
+
+	m, ok := collector.Snapshot()["upstream"]
+	if !ok {
+		t.Fatalf("Expected metrics for breaker upstream")
+	}
+	if m.Calls[OutcomeSuccess] != 1 || m.Calls[OutcomeFailure] != 2 {
+		t.Errorf("Expected 1 success and 2 failures - got %v", m.Calls)
+	}
+	if m.Rejections != 1 {
+		t.Errorf("Expected 1 rejection - got %d", m.Rejections)
+	}
+	if m.State != StateOpen || m.Transitions[StateOpen] != 1 {
+		t.Errorf("Expected 1 transition to %s - got %s %v", StateOpen, m.State, m.Transitions)
+	}
+	expected := []uint64{0, 1, 2}
+	for i, count := range m.Latency.Counts {
+		if count != expected[i] {
+			t.Errorf("Expected latency bucket counts %v - got %v", expected, m.Latency.Counts)
+			break
+		}
+	}
+	if m.Latency.Sum != 1050*time.Millisecond {
+		t.Errorf("Expected latency sum of 1.05s - got %v", m.Latency.Sum)
+	}
+
+	rec := httptest.NewRecorder()
+	PrometheusHandler(collector).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+
+	lines := []string{
+		`circuit_breaker_state{name="upstream",state="open"} 1`,
+		`circuit_breaker_calls_total{name="upstream",outcome="failure"} 2`,
+		`circuit_breaker_rejections_total{name="upstream"} 1`,
+		`circuit_breaker_transitions_total{name="upstream",state="open"} 1`,
+		`circuit_breaker_call_duration_seconds_bucket{name="upstream",le="0.1"} 1`,
+		`circuit_breaker_call_duration_seconds_bucket{name="upstream",le="+Inf"} 3`,
+		`circuit_breaker_call_duration_seconds_sum{name="upstream"} 1.05`,
+		"# TYPE circuit_breaker_call_duration_seconds histogram",
+	}
+	for _, line := range lines {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("Expected exposition to contain %q - got:\n%s", line, body)
+		}
+	}
+}
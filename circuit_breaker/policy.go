@@ -0,0 +1,187 @@
+package circuitbreaker
+
+import "time"
+
+// TripPolicy observes the outcome of the calls made through a closed
+// CircuitBreaker and decides when it should trip.
+//
+// Implementations are stateful and are not required to be thread safe:
+// the CircuitBreaker serializes every call to its own TripPolicy
+type TripPolicy interface {
+	// Record registers the outcome of a call completed at the given time
+	Record(now time.Time, failed bool)
+	// ShouldTrip reports whether the breaker should open
+	ShouldTrip(now time.Time) bool
+	// Reset discards every recorded outcome
+	Reset()
+}
+
+// ConsecutiveFailures returns a TripPolicy constructor whose policies
+// trip after n consecutive failed calls
+func ConsecutiveFailures(n uint) func() TripPolicy {
+	return func() TripPolicy {
+		return &consecutiveFailures{threshold: n}
+	}
+}
+
+type consecutiveFailures struct {
+	threshold uint
+	failures  uint
+}
+
+func (p *consecutiveFailures) Record(now time.Time, failed bool) {
+	if failed {
+		p.failures++
+	} else {
+		p.failures = 0
+	}
+}
+
+func (p *consecutiveFailures) ShouldTrip(now time.Time) bool {
+	return p.failures > 0 && p.failures >= p.threshold
+}
+
+func (p *consecutiveFailures) Reset() {
+	p.failures = 0
+}
+
+// CountWindow returns a TripPolicy constructor whose policies trip when the
+// ratio of failed calls among the last size calls reaches rate.
+//
+// No decision is taken until at least minCalls calls have been recorded
+func CountWindow(size uint, rate float64, minCalls uint) func() TripPolicy {
+	if size == 0 {
+		size = 1
+	}
+
+	return func() TripPolicy {
+		return &countWindow{
+			outcomes: make([]bool, size),
+			rate:     rate,
+			minCalls: minCalls,
+		}
+	}
+}
+
+type countWindow struct {
+	// ring buffer of outcomes, true for failed calls
+	outcomes []bool
+	next     int
+	calls    uint
+	failures uint
+	rate     float64
+	minCalls uint
+}
+
+func (w *countWindow) Record(now time.Time, failed bool) {
+	if w.calls == uint(len(w.outcomes)) {
+		// evict the oldest outcome
+		if w.outcomes[w.next] {
+			w.failures--
+		}
+	} else {
+		w.calls++
+	}
+
+	w.outcomes[w.next] = failed
+	if failed {
+		w.failures++
+	}
+	w.next = (w.next + 1) % len(w.outcomes)
+}
+
+func (w *countWindow) ShouldTrip(now time.Time) bool {
+	return exceedsRate(w.calls, w.failures, w.rate, w.minCalls)
+}
+
+func (w *countWindow) Reset() {
+	for i := range w.outcomes {
+		w.outcomes[i] = false
+	}
+	w.next, w.calls, w.failures = 0, 0, 0
+}
+
+// timeWindowBuckets is the number of buckets a time window is split into
+const timeWindowBuckets = 10
+
+// TimeWindow returns a TripPolicy constructor whose policies trip when the
+// ratio of failed calls during the last d reaches rate.
+//
+// No decision is taken until at least minCalls calls have been recorded
+// in the window. The window slides in steps of d/10
+func TimeWindow(d time.Duration, rate float64, minCalls uint) func() TripPolicy {
+	width := d / timeWindowBuckets
+	if width <= 0 {
+		width = 1
+	}
+
+	return func() TripPolicy {
+		return &timeWindow{
+			width:    width,
+			buckets:  make([]bucket, timeWindowBuckets),
+			rate:     rate,
+			minCalls: minCalls,
+		}
+	}
+}
+
+// bucket aggregates the outcomes recorded during one slice of a time window
+type bucket struct {
+	epoch    int64
+	calls    uint
+	failures uint
+}
+
+type timeWindow struct {
+	width    time.Duration
+	buckets  []bucket
+	rate     float64
+	minCalls uint
+}
+
+func (w *timeWindow) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(w.width)
+}
+
+func (w *timeWindow) Record(now time.Time, failed bool) {
+	epoch := w.epoch(now)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	// the bucket holds outcomes from an older slice
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+
+	b.calls++
+	if failed {
+		b.failures++
+	}
+}
+
+func (w *timeWindow) ShouldTrip(now time.Time) bool {
+	epoch := w.epoch(now)
+
+	var calls, failures uint
+	for _, b := range w.buckets {
+		if age := epoch - b.epoch; age >= 0 && age < int64(len(w.buckets)) {
+			calls += b.calls
+			failures += b.failures
+		}
+	}
+
+	return exceedsRate(calls, failures, w.rate, w.minCalls)
+}
+
+func (w *timeWindow) Reset() {
+	for i := range w.buckets {
+		w.buckets[i] = bucket{}
+	}
+}
+
+// exceedsRate reports whether enough calls were made and the ratio
+// of failed ones reached rate
+func exceedsRate(calls, failures uint, rate float64, minCalls uint) bool {
+	if calls == 0 || calls < minCalls {
+		return false
+	}
+	return float64(failures)/float64(calls) >= rate
+}
@@ -0,0 +1,48 @@
+package circuitbreaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTripPolicies(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		policy   func() TripPolicy
+		outcomes []bool
+		step     time.Duration
+		expected bool
+	}{
+		{"consecutive failures reached", ConsecutiveFailures(3), []bool{true, true, true}, 0, true},
+		{"consecutive failures interrupted", ConsecutiveFailures(3), []bool{true, true, false, true, true}, 0, false},
+		{"count window below min calls", CountWindow(10, 0.5, 5), []bool{true, true, true, true}, 0, false},
+		{"count window rate reached", CountWindow(10, 0.4, 5), []bool{true, false, true, false, false}, 0, true},
+		{"count window rate not reached", CountWindow(10, 0.5, 5), []bool{true, false, true, false, false}, 0, false},
+		{"count window evicts old failures", CountWindow(4, 0.5, 1), []bool{true, true, true, false, false, false, false}, 0, false},
+		{"time window rate reached", TimeWindow(10*time.Second, 0.5, 4), []bool{true, false, true, false}, time.Second, true},
+		{"time window expires old failures", TimeWindow(10*time.Second, 0.5, 1), []bool{true, true, false}, 10 * time.Second, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy()
+			now := start
+			for _, failed := range tt.outcomes {
+				p.Record(now, failed)
+				now = now.Add(tt.step)
+			}
+			now = now.Add(-tt.step)
+
+			if res := p.ShouldTrip(now); res != tt.expected {
+				t.Errorf("Expected ShouldTrip() to return %v - got %v", tt.expected, res)
+			}
+
+			p.Reset()
+			if p.ShouldTrip(now) {
+				t.Errorf("Expected ShouldTrip() to return false after Reset()")
+			}
+		})
+	}
+}
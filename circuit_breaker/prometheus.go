@@ -0,0 +1,93 @@
+package circuitbreaker
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// states lists every State, in the order they are exported
+var states = []State{StateClosed, StateHalfOpen, StateOpen, StateForcedOpen, StateForcedClosed}
+
+// outcomes lists every Outcome, in the order they are exported
+var outcomes = []Outcome{OutcomeSuccess, OutcomeFailure, OutcomeIgnored}
+
+// labelEscaper escapes label values as required by the Prometheus text format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusHandler returns an http.Handler exposing the metrics gathered
+// by the given Collector in the Prometheus text exposition format
+func PrometheusHandler(c *Collector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		bw := bufio.NewWriter(w)
+		writePrometheus(bw, c.Snapshot())
+		bw.Flush()
+	})
+}
+
+func writePrometheus(w *bufio.Writer, snapshot map[string]BreakerMetrics) {
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	header(w, "circuit_breaker_state", "gauge", "Current state of the circuit breaker, 1 for the active state.")
+	for _, name := range names {
+		for _, s := range states {
+			value := 0
+			if snapshot[name].State == s {
+				value = 1
+			}
+			fmt.Fprintf(w, "circuit_breaker_state{name=\"%s\",state=\"%s\"} %d\n", escape(name), s, value)
+		}
+	}
+
+	header(w, "circuit_breaker_calls_total", "counter", "Calls which reached the circuit, by outcome.")
+	for _, name := range names {
+		for _, o := range outcomes {
+			fmt.Fprintf(w, "circuit_breaker_calls_total{name=\"%s\",outcome=\"%s\"} %d\n", escape(name), o, snapshot[name].Calls[o])
+		}
+	}
+
+	header(w, "circuit_breaker_rejections_total", "counter", "Calls rejected by the circuit breaker.")
+	for _, name := range names {
+		fmt.Fprintf(w, "circuit_breaker_rejections_total{name=\"%s\"} %d\n", escape(name), snapshot[name].Rejections)
+	}
+
+	header(w, "circuit_breaker_transitions_total", "counter", "State transitions of the circuit breaker, by target state.")
+	for _, name := range names {
+		for _, s := range states {
+			fmt.Fprintf(w, "circuit_breaker_transitions_total{name=\"%s\",state=\"%s\"} %d\n", escape(name), s, snapshot[name].Transitions[s])
+		}
+	}
+
+	header(w, "circuit_breaker_call_duration_seconds", "histogram", "Duration of the calls which reached the circuit.")
+	for _, name := range names {
+		h := snapshot[name].Latency
+
+		// buckets are cumulative in the exposition format
+		var cumulative uint64
+		for i, bound := range h.Buckets {
+			cumulative += h.Counts[i]
+			le := strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)
+			fmt.Fprintf(w, "circuit_breaker_call_duration_seconds_bucket{name=\"%s\",le=\"%s\"} %d\n", escape(name), le, cumulative)
+		}
+		fmt.Fprintf(w, "circuit_breaker_call_duration_seconds_bucket{name=\"%s\",le=\"+Inf\"} %d\n", escape(name), h.Count)
+		fmt.Fprintf(w, "circuit_breaker_call_duration_seconds_sum{name=\"%s\"} %s\n", escape(name), strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "circuit_breaker_call_duration_seconds_count{name=\"%s\"} %d\n", escape(name), h.Count)
+	}
+}
+
+func header(w *bufio.Writer, metric, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric, help, metric, kind)
+}
+
+func escape(label string) string {
+	return labelEscaper.Replace(label)
+}
@@ -0,0 +1,126 @@
+package circuitbreaker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Registry lazily creates, and keeps track of, CircuitBreakers identified by name
+type Registry[T any] struct {
+	defaults Settings
+
+	m         sync.RWMutex
+	overrides map[string]func(*Settings)
+	breakers  map[string]*CircuitBreaker[T]
+}
+
+// NewRegistry creates an empty Registry whose breakers are configured
+// by the given default Settings
+func NewRegistry[T any](defaults Settings) *Registry[T] {
+	return &Registry[T]{
+		defaults:  defaults,
+		overrides: make(map[string]func(*Settings)),
+		breakers:  make(map[string]*CircuitBreaker[T]),
+	}
+}
+
+// Override registers a function customizing the Settings of the breaker with
+// the given name, receiving a copy of the default Settings.
+//
+// It only affects breakers created after the call
+func (r *Registry[T]) Override(name string, f func(s *Settings)) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	r.overrides[name] = f
+}
+
+// Get returns the CircuitBreaker with the given name, creating it if needed
+func (r *Registry[T]) Get(name string) *CircuitBreaker[T] {
+	r.m.RLock()
+	cb, ok := r.breakers[name]
+	r.m.RUnlock()
+	if ok {
+		return cb
+	}
+
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// another goroutine may have created it in the meantime
+	if cb, ok := r.breakers[name]; ok {
+		return cb
+	}
+
+	s := r.defaults
+	if f, ok := r.overrides[name]; ok {
+		f(&s)
+	}
+	s.Name = name
+
+	cb = NewCircuitBreaker[T](s)
+	r.breakers[name] = cb
+	return cb
+}
+
+// List returns the Status of every breaker in the Registry, sorted by name
+func (r *Registry[T]) List() []Status {
+	r.m.RLock()
+	breakers := make([]*CircuitBreaker[T], 0, len(r.breakers))
+	for _, cb := range r.breakers {
+		breakers = append(breakers, cb)
+	}
+	r.m.RUnlock()
+
+	statuses := make([]Status, len(breakers))
+	for i, cb := range breakers {
+		statuses[i] = cb.Status()
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+
+	return statuses
+}
+
+// ForceOpen forces the breaker with the given name open, see CircuitBreaker.ForceOpen
+func (r *Registry[T]) ForceOpen(name string) error {
+	cb, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	return cb.ForceOpen()
+}
+
+// ForceClosed forces the breaker with the given name closed, see CircuitBreaker.ForceClosed
+func (r *Registry[T]) ForceClosed(name string) error {
+	cb, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	return cb.ForceClosed()
+}
+
+// Reset clears any override on the breaker with the given name and closes it,
+// discarding its counts
+func (r *Registry[T]) Reset(name string) error {
+	cb, err := r.lookup(name)
+	if err != nil {
+		return err
+	}
+	return cb.Reset()
+}
+
+// lookup returns the breaker with the given name, without creating it,
+// so that operations on a mistyped name fail rather than creating a new breaker
+func (r *Registry[T]) lookup(name string) (*CircuitBreaker[T], error) {
+	r.m.RLock()
+	defer r.m.RUnlock()
+
+	cb, ok := r.breakers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownBreaker, name)
+	}
+	return cb, nil
+}
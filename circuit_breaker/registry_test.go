@@ -0,0 +1,95 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry[string](Settings{Threshold: 0, Timeout: time.Minute})
+	r.Override("tolerant", func(s *Settings) {
+		s.Threshold = 5
+	})
+	ctx := context.Background()
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+
+	if r.Get("strict") != r.Get("strict") {
+		t.Errorf("Expected Get() to return the same breaker for the same name")
+	}
+
+	r.Get("strict").Execute(ctx, failing)
+	r.Get("tolerant").Execute(ctx, failing)
+
+	statuses := r.List()
+	expected := []struct {
+		name  string
+		state State
+	}{
+		{"strict", StateOpen},
+		{"tolerant", StateClosed},
+	}
+	if len(statuses) != len(expected) {
+		t.Fatalf("Expected %d breakers - got %d", len(expected), len(statuses))
+	}
+	for i, e := range expected {
+		if statuses[i].Name != e.name || statuses[i].State != e.state {
+			t.Errorf("Expected breaker %s to be %s - got %s %s", e.name, e.state, statuses[i].Name, statuses[i].State)
+		}
+	}
+
+	_, err := r.Get("strict").Execute(ctx, failing)
+	var openErr *OpenError
+	if !errors.As(err, &openErr) || openErr.Name != "strict" {
+		t.Errorf("Expected an *OpenError from breaker strict - got %v", err)
+	}
+
+	if err := r.ForceClosed("strict"); err != nil {
+		t.Errorf("Expected no error - got %v", err)
+	}
+	if state := r.Get("strict").State(); state != StateForcedClosed {
+		t.Errorf("Expected breaker strict to be %s - got %s", StateForcedClosed, state)
+	}
+
+	if err := r.ForceOpen("tolerant"); err != nil {
+		t.Errorf("Expected no error - got %v", err)
+	}
+	if state := r.Get("tolerant").State(); state != StateForcedOpen {
+		t.Errorf("Expected breaker tolerant to be %s - got %s", StateForcedOpen, state)
+	}
+
+	if err := r.Reset("tolerant"); err != nil {
+		t.Errorf("Expected no error - got %v", err)
+	}
+	if status := r.Get("tolerant").Status(); status.State != StateClosed || status.Counts != (Counts{}) {
+		t.Errorf("Expected breaker tolerant to be reset - got %+v", status)
+	}
+}
+
+func TestRegistryUnknownBreaker(t *testing.T) {
+	r := NewRegistry[string](Settings{})
+	r.Get("known")
+
+	operations := []struct {
+		name string
+		f    func(string) error
+	}{
+		{"ForceOpen", r.ForceOpen},
+		{"ForceClosed", r.ForceClosed},
+		{"Reset", r.Reset},
+	}
+
+	for _, op := range operations {
+		t.Run(op.name, func(t *testing.T) {
+			if err := op.f("knwon"); !errors.Is(err, ErrUnknownBreaker) {
+				t.Errorf("Expected error %v - got %v", ErrUnknownBreaker, err)
+			}
+		})
+	}
+
+	// mistyped names do not create new breakers
+	if n := len(r.List()); n != 1 {
+		t.Errorf("Expected 1 breaker - got %d", n)
+	}
+}
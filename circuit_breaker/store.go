@@ -0,0 +1,56 @@
+package circuitbreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// Record holds the state of a CircuitBreaker, as saved in a Store
+type Record struct {
+	State      State
+	Generation uint64
+	Counts     Counts
+	// HalfOpenRequests is the number of trial calls in flight
+	HalfOpenRequests uint
+	// HalfOpenUntil is when the trial slots lapse, in case their calls
+	// never report back, such as after a Store failure or a crash
+	HalfOpenUntil time.Time
+	// Trips is the number of times the breaker tripped since it was last closed
+	Trips      uint
+	OpenPeriod time.Duration
+	OpenUntil  time.Time
+}
+
+// Store persists the Records of CircuitBreakers identified by name, allowing
+// several breakers, possibly living in different processes, to share their state.
+//
+// Trip policies are not shared: every breaker decides on its own when to trip,
+// based on the calls it made, while all of them observe the resulting state
+type Store interface {
+	// Update atomically loads the Record with the given name, or a zero Record
+	// if missing, passes it to f and saves it back once f returns
+	Update(name string, f func(r *Record)) error
+}
+
+// MemoryStore is a Store keeping Records in memory, which can be shared
+// by breakers living in the same process
+type MemoryStore struct {
+	m       sync.Mutex
+	records map[string]Record
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Update atomically updates the Record with the given name
+func (s *MemoryStore) Update(name string, f func(r *Record)) error {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	r := s.records[name]
+	f(&r)
+	s.records[name] = r
+	return nil
+}
@@ -0,0 +1,181 @@
+package circuitbreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"patterns/clock"
+)
+
+var errStore = errors.New("store unavailable")
+
+// flakyStore fails the next update once failNext is set
+type flakyStore struct {
+	Store
+	failNext bool
+}
+
+func (s *flakyStore) Update(name string, f func(r *Record)) error {
+	if s.failNext {
+		s.failNext = false
+		return errStore
+	}
+	return s.Store.Update(name, f)
+}
+
+func TestSharedStore(t *testing.T) {
+	fileStore := func(t *testing.T) Store {
+		s, err := NewFileStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Expected no error - got %v", err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{"memory store", func(t *testing.T) Store { return NewMemoryStore() }},
+		{"file store", fileStore},
+	}
+
+	ctx := context.Background()
+	failing := func(ctx context.Context) (string, error) { return "", errFailedService }
+	working := func(ctx context.Context) (string, error) { return "OK", nil }
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store(t)
+			settings := Settings{Name: "upstream", Threshold: 0, Timeout: time.Minute, Store: store}
+			replica1 := NewCircuitBreaker[string](settings)
+			replica2 := NewCircuitBreaker[string](settings)
+
+			var transitions []State
+			replica2.OnStateChange(func(from, to State) {
+				transitions = append(transitions, to)
+			})
+
+			// a breaker with another name is not affected
+			settings.Name = "other"
+			other := NewCircuitBreaker[string](settings)
+
+			replica1.Execute(ctx, failing)
+
+			if _, err := replica2.Execute(ctx, working); !errors.Is(err, ErrOpenState) {
+				t.Errorf("Expected replica to be open - got %v", err)
+			}
+			if len(transitions) != 1 || transitions[0] != StateOpen {
+				t.Errorf("Expected replica to observe transition to %s - got %v", StateOpen, transitions)
+			}
+			if _, err := other.Execute(ctx, working); err != nil {
+				t.Errorf("Expected other breaker to be closed - got %v", err)
+			}
+
+			if err := replica2.Reset(); err != nil {
+				t.Fatalf("Expected no error - got %v", err)
+			}
+			if state := replica1.State(); state != StateClosed {
+				t.Errorf("Expected replica to be %s after Reset() - got %s", StateClosed, state)
+			}
+		})
+	}
+}
+
+func TestFileStoreConcurrentUpdates(t *testing.T) {
+	dir := t.TempDir()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// every goroutine uses its own store, like separate processes
+			s, err := NewFileStore(dir)
+			if err != nil {
+				t.Errorf("Expected no error - got %v", err)
+				return
+			}
+			for j := 0; j < 20; j++ {
+				if err := s.Update("counter", func(r *Record) { r.Counts.Requests++ }); err != nil {
+					t.Errorf("Expected no error - got %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	s, _ := NewFileStore(dir)
+	var requests uint
+	s.Update("counter", func(r *Record) { requests = r.Counts.Requests })
+	if requests != 200 {
+		t.Errorf("Expected 200 requests - got %d", requests)
+	}
+}
+
+func TestHalfOpenLease(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := &flakyStore{Store: NewMemoryStore()}
+	cb := NewCircuitBreaker[string](Settings{Threshold: 0, Timeout: time.Minute, Clock: clk, Store: store})
+	ctx := context.Background()
+
+	cb.Execute(ctx, func(ctx context.Context) (string, error) { return "", errFailedService })
+	clk.Advance(time.Minute)
+
+	// the outcome of the trial call is lost, leaking its slot
+	cb.Execute(ctx, func(ctx context.Context) (string, error) {
+		store.failNext = true
+		return "OK", nil
+	})
+
+	working := func(ctx context.Context) (string, error) { return "OK", nil }
+	var openErr *OpenError
+	if _, err := cb.Execute(ctx, working); !errors.As(err, &openErr) || openErr.State != StateHalfOpen {
+		t.Errorf("Expected the trial slot to be taken - got %v", err)
+	}
+
+	// the slot lapses after HalfOpenTimeout
+	clk.Advance(10 * time.Minute)
+	if _, err := cb.Execute(ctx, working); err != nil {
+		t.Errorf("Expected no error - got %v", err)
+	}
+	if state := cb.State(); state != StateClosed {
+		t.Errorf("Expected breaker to be %s - got %s", StateClosed, state)
+	}
+}
+
+func TestHalfOpenSlowTrial(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected State
+	}{
+		{"slow trial success closes the breaker", nil, StateClosed},
+		{"slow trial failure opens the breaker", errFailedService, StateOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+			cb := NewCircuitBreaker[string](Settings{Threshold: 0, Timeout: time.Minute, Clock: clk})
+			ctx := context.Background()
+
+			cb.Execute(ctx, func(ctx context.Context) (string, error) { return "", errFailedService })
+			clk.Advance(time.Minute)
+
+			// the trial call takes longer than Timeout
+			cb.Execute(ctx, func(ctx context.Context) (string, error) {
+				clk.Advance(2 * time.Minute)
+				return "OK", tt.err
+			})
+
+			if state := cb.State(); state != tt.expected {
+				t.Errorf("Expected breaker to be %s - got %s", tt.expected, state)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock provides the current time and the timers used by the time-based
+// stability patterns, allowing tests to replace the real time with a Fake
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// After waits for d to elapse and then sends the current time on the returned channel
+	After(d time.Duration) <-chan time.Time
+	// NewTicker returns a Ticker sending the current time every d
+	NewTicker(d time.Duration) Ticker
+	// WithTimeout returns a copy of ctx which is cancelled with
+	// context.DeadlineExceeded as its cause once d elapses
+	WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc)
+}
+
+// Ticker delivers ticks at fixed intervals
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered
+	C() <-chan time.Time
+	// Stop turns off the Ticker
+	Stop()
+}
+
+// Real returns a Clock backed by the time package
+func Real() Clock {
+	return realClock{}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+func (realClock) WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, d)
+}
+
+type realTicker struct {
+	t *time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTicker) Stop() {
+	t.t.Stop()
+}
@@ -0,0 +1,91 @@
+package clock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFakeAfter(t *testing.T) {
+	f := NewFake(start)
+	ch := f.After(time.Second)
+
+	f.Advance(999 * time.Millisecond)
+	select {
+	case <-ch:
+		t.Fatalf("Expected After() not to fire before its duration")
+	default:
+	}
+
+	f.Advance(time.Millisecond)
+	select {
+	case now := <-ch:
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("Expected to receive %v - got %v", start.Add(time.Second), now)
+		}
+	default:
+		t.Fatalf("Expected After() to fire")
+	}
+
+	if now := f.Now(); !now.Equal(start.Add(time.Second)) {
+		t.Errorf("Expected Now() to return %v - got %v", start.Add(time.Second), now)
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	f := NewFake(start)
+	ticker := f.NewTicker(time.Second)
+
+	for i := 1; i <= 3; i++ {
+		f.Advance(time.Second)
+		select {
+		case now := <-ticker.C():
+			if expected := start.Add(time.Duration(i) * time.Second); !now.Equal(expected) {
+				t.Errorf("Expected tick at %v - got %v", expected, now)
+			}
+		default:
+			t.Fatalf("Expected tick %d", i)
+		}
+	}
+
+	ticker.Stop()
+	f.Advance(time.Second)
+	select {
+	case <-ticker.C():
+		t.Errorf("Expected no tick after Stop()")
+	default:
+	}
+}
+
+func TestFakeWithTimeout(t *testing.T) {
+	f := NewFake(start)
+	ctx, cancel := f.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	f.Advance(500 * time.Millisecond)
+	if ctx.Err() != nil {
+		t.Fatalf("Expected context not to be done - got %v", ctx.Err())
+	}
+
+	f.Advance(500 * time.Millisecond)
+	if cause := context.Cause(ctx); !errors.Is(cause, context.DeadlineExceeded) {
+		t.Errorf("Expected cause %v - got %v", context.DeadlineExceeded, cause)
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	f := NewFake(start)
+	done := make(chan struct{})
+
+	go func() {
+		<-f.After(time.Second)
+		close(done)
+	}()
+
+	f.BlockUntil(1)
+	f.Advance(time.Second)
+	<-done
+}
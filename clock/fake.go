@@ -0,0 +1,182 @@
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Fake is a Clock whose time only moves forward when told to, firing
+// its timers synchronously and deterministically
+type Fake struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// fakeTimer is a pending After, Ticker or context deadline of a Fake clock
+type fakeTimer struct {
+	when time.Time
+	// period is positive for tickers, which are rescheduled after firing
+	period time.Duration
+	fire   func(now time.Time)
+}
+
+// NewFake creates a Fake clock set to the given time
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.m)
+	return f
+}
+
+// Now returns the current time of the Fake clock
+func (f *Fake) Now() time.Time {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	return f.now
+}
+
+// After returns a channel receiving the time once the clock is advanced by d
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	f.schedule(d, 0, func(now time.Time) {
+		ch <- now
+	})
+	return ch
+}
+
+// NewTicker returns a Ticker firing every time the clock is advanced by d.
+// Like a real Ticker, it drops ticks for slow receivers
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	ch := make(chan time.Time, 1)
+	t := f.schedule(d, d, func(now time.Time) {
+		select {
+		case ch <- now:
+		default:
+		}
+	})
+	return &fakeTicker{clock: f, timer: t, c: ch}
+}
+
+// WithTimeout returns a copy of ctx which is cancelled, with context.DeadlineExceeded
+// as its cause, once the clock is advanced by d.
+//
+// The returned context does not report a deadline, and its Err method returns
+// context.Canceled: use context.Cause to tell a timeout apart
+func (f *Fake) WithTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	t := f.schedule(d, 0, func(now time.Time) {
+		cancel(context.DeadlineExceeded)
+	})
+
+	return ctx, func() {
+		f.remove(t)
+		cancel(context.Canceled)
+	}
+}
+
+// Advance moves the clock forward by d, firing, in chronological order,
+// every timer expiring in the meantime
+func (f *Fake) Advance(d time.Duration) {
+	f.m.Lock()
+	end := f.now.Add(d)
+
+	for {
+		t := f.next(end)
+		if t == nil {
+			break
+		}
+
+		f.now = t.when
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			f.removeLocked(t)
+		}
+
+		// timers may interact with the clock, so they run unlocked
+		now := f.now
+		f.m.Unlock()
+		t.fire(now)
+		f.m.Lock()
+	}
+
+	f.now = end
+	f.m.Unlock()
+}
+
+// BlockUntil waits until at least n timers are pending, which allows
+// tests to advance the clock only after a goroutine started waiting on it
+func (f *Fake) BlockUntil(n int) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	for len(f.timers) < n {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) schedule(d, period time.Duration, fire func(now time.Time)) *fakeTimer {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	t := &fakeTimer{when: f.now.Add(d), period: period, fire: fire}
+	if d <= 0 {
+		fire(f.now)
+		if period == 0 {
+			return t
+		}
+		t.when = f.now.Add(period)
+	}
+
+	f.timers = append(f.timers, t)
+	f.cond.Broadcast()
+	return t
+}
+
+// next returns the earliest timer expiring not later than end
+func (f *Fake) next(end time.Time) *fakeTimer {
+	var next *fakeTimer
+	for _, t := range f.timers {
+		if !t.when.After(end) && (next == nil || t.when.Before(next.when)) {
+			next = t
+		}
+	}
+	return next
+}
+
+func (f *Fake) remove(t *fakeTimer) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.removeLocked(t)
+}
+
+func (f *Fake) removeLocked(t *fakeTimer) {
+	for i, pending := range f.timers {
+		if pending == t {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			return
+		}
+	}
+}
+
+type fakeTicker struct {
+	clock *Fake
+	timer *fakeTimer
+	c     chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.remove(t.timer)
+}
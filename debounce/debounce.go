@@ -4,35 +4,43 @@ import (
 	"context"
 	"sync"
 	"time"
+
+	"patterns/clock"
+	"patterns/stability"
 )
 
 // Circuit represents a function interacting with an upstream service;
 // it should include an error in its return list
-type Circuit func(context.Context) (string, error)
+type Circuit[T any] = stability.Effector[T]
 
 // DebounceFirst is a function-first implementation that wraps a Circuit function
 // forcing overlapping calls to wait untill the result is cached and guarantees circuit
 // is called exactly once, at the beginning of a cluster of calls
-func DebounceFirst(circuit Circuit, d time.Duration) Circuit {
+func DebounceFirst[T any](circuit Circuit[T], d time.Duration) Circuit[T] {
+	return DebounceFirstWithClock(circuit, d, clock.Real())
+}
+
+// DebounceFirstWithClock is like DebounceFirst, but measures clusters of calls using the given Clock
+func DebounceFirstWithClock[T any](circuit Circuit[T], d time.Duration, clk clock.Clock) Circuit[T] {
 	var threshold time.Time
-	var result string
+	var result T
 	var err error
 	var m sync.Mutex
 
-	return func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (T, error) {
 		// provides thread safety for the entire function
 		m.Lock()
 		defer func() {
 			// reset the time at which a cluster ends
-			threshold = time.Now().Add(d)
+			threshold = clk.Now().Add(d)
 			m.Unlock()
 		}()
 
-		if time.Now().Before(threshold) {
+		if clk.Now().Before(threshold) {
 			return result, err
 		}
 
-		result, err := circuit(ctx)
+		result, err = circuit(ctx)
 		return result, err
 	}
 }
@@ -41,22 +49,27 @@ func DebounceFirst(circuit Circuit, d time.Duration) Circuit {
 // and waits for a pause after a cluster of calls before calling the inner function.
 // Since this implementation won't provide an immediate response, it is useful only if
 // your function doesn't need results ASAP
-func DebounceLast(circuit Circuit, d time.Duration) Circuit {
-	var threshold time.Time = time.Now()
-	var ticker *time.Ticker
-	var result string
+func DebounceLast[T any](circuit Circuit[T], d time.Duration) Circuit[T] {
+	return DebounceLastWithClock(circuit, d, clock.Real())
+}
+
+// DebounceLastWithClock is like DebounceLast, but measures pauses using the given Clock
+func DebounceLastWithClock[T any](circuit Circuit[T], d time.Duration, clk clock.Clock) Circuit[T] {
+	var threshold time.Time = clk.Now()
+	var ticker clock.Ticker
+	var result T
 	var err error
 	var once sync.Once
 	var m sync.Mutex
 
-	return func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (T, error) {
 		m.Lock()
 		defer m.Unlock()
 
-		threshold = time.Now().Add(d)
+		threshold = clk.Now().Add(d)
 
 		once.Do(func() {
-			ticker = time.NewTicker(time.Millisecond * 100)
+			ticker = clk.NewTicker(time.Millisecond * 100)
 
 			go func() {
 				defer func() {
@@ -69,10 +82,10 @@ func DebounceLast(circuit Circuit, d time.Duration) Circuit {
 
 				for {
 					select {
-					case <-ticker.C:
+					case <-ticker.C():
 						m.Lock()
 						// verify enough time has passed since the last call
-						if time.Now().After(threshold) {
+						if clk.Now().After(threshold) {
 							result, err = circuit(ctx)
 							m.Unlock()
 							return
@@ -80,7 +93,8 @@ func DebounceLast(circuit Circuit, d time.Duration) Circuit {
 						m.Unlock()
 					case <-ctx.Done():
 						m.Lock()
-						result, err = "", ctx.Err()
+						var zero T
+						result, err = zero, ctx.Err()
 						m.Unlock()
 						return
 					}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"patterns/clock"
 )
 
 var callCounter int
@@ -22,10 +24,14 @@ func TestDebounceFirst(t *testing.T) {
 	circuit := DebounceFirst(testCircuit, wait)
 
 	for i := 0; i < 100; i++ {
-		_, err := circuit(ctx)
+		res, err := circuit(ctx)
 		if err != nil {
 			t.Errorf("Expected no error - got %s", err)
 		}
+		// calls within the cluster get the cached result
+		if res != "OK" {
+			t.Errorf("Expected 'OK' - got '%s'", res)
+		}
 	}
 
 	if callCounter != expectedCalls {
@@ -53,3 +59,59 @@ func TestDebounceLast(t *testing.T) {
 		t.Errorf("Expected %d to circuit() - got %d", expectedCalls, callCounter)
 	}
 }
+
+func TestDebounceWithClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	ctx := context.Background()
+
+	t.Run("function-first", func(t *testing.T) {
+		callCounter = 0
+		circuit := DebounceFirstWithClock(testCircuit, time.Second, clk)
+
+		steps := []struct {
+			advance  time.Duration
+			expected int
+		}{
+			{0, 1},
+			{500 * time.Millisecond, 1},
+			// every call extends the cluster
+			{900 * time.Millisecond, 1},
+			{time.Second, 2},
+		}
+		for _, s := range steps {
+			clk.Advance(s.advance)
+			if res, err := circuit(ctx); err != nil || res != "OK" {
+				t.Errorf("Expected 'OK' and no error - got '%s' and %v", res, err)
+			}
+			if callCounter != s.expected {
+				t.Errorf("Expected %d calls to circuit() - got %d", s.expected, callCounter)
+			}
+		}
+	})
+
+	t.Run("function-last", func(t *testing.T) {
+		called := make(chan struct{}, 1)
+		circuit := DebounceLastWithClock(func(ctx context.Context) (string, error) {
+			called <- struct{}{}
+			return "OK", nil
+		}, time.Second, clk)
+
+		for i := 0; i < 10; i++ {
+			circuit(ctx)
+		}
+
+		clk.Advance(500 * time.Millisecond)
+		select {
+		case <-called:
+			t.Fatalf("Expected circuit() not to be called before a pause")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		clk.Advance(time.Second)
+		select {
+		case <-called:
+		case <-time.After(time.Second):
+			t.Errorf("Expected circuit() to be called after a pause")
+		}
+	})
+}
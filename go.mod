@@ -1,3 +1,3 @@
 module patterns
 
-go 1.20
+go 1.24
@@ -0,0 +1,178 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"patterns/clock"
+	"patterns/stability"
+)
+
+// minSamples is the number of latencies needed before a percentile is trusted
+const minSamples = 10
+
+// Effector is a function interacting with a service
+type Effector[T any] = stability.Effector[T]
+
+// Options configures the hedging logic applied by HedgeWithOptions
+type Options struct {
+	// Delay is the time to wait for a call before launching a hedge.
+	// When Percentile is set, it is only used until enough latencies are known
+	Delay time.Duration
+	// Percentile, when in (0, 1], learns the delay from recent calls: a hedge is
+	// launched once a call is slower than the given percentile of their latencies
+	Percentile float64
+	// Window is the number of recent latencies the Percentile is computed on.
+	// Defaults to 100
+	Window int
+	// MaxHedges is the maximum number of hedges launched for a single call
+	MaxHedges uint
+	// Clock is used to wait before launching hedges. Defaults to clock.Real()
+	Clock clock.Clock
+}
+
+// Hedge wraps an Effector function to reduce tail latency.
+//
+// When a call takes longer than delay, up to maxHedges duplicate calls are
+// launched, one every delay: the first successful result is returned, and the
+// other calls are cancelled through their context. The Effector must therefore
+// be safe to call more than once
+func Hedge[T any](e Effector[T], delay time.Duration, maxHedges uint) Effector[T] {
+	return HedgeWithOptions(e, Options{Delay: delay, MaxHedges: maxHedges})
+}
+
+// HedgeWithClock is like Hedge, but waits before launching hedges using the given Clock
+func HedgeWithClock[T any](e Effector[T], delay time.Duration, maxHedges uint, clk clock.Clock) Effector[T] {
+	return HedgeWithOptions(e, Options{Delay: delay, MaxHedges: maxHedges, Clock: clk})
+}
+
+// HedgeWithOptions wraps an Effector function to provide hedging logic configured by the given Options.
+//
+// If every call fails, the returned error joins the errors of each of them
+func HedgeWithOptions[T any](e Effector[T], opts Options) Effector[T] {
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	if opts.Window <= 0 {
+		opts.Window = 100
+	}
+	latencies := newLatencies(opts.Window)
+
+	type result struct {
+		value   T
+		err     error
+		latency time.Duration
+	}
+
+	return func(ctx context.Context) (T, error) {
+		var zero T
+		if ctx.Err() != nil {
+			return zero, ctx.Err()
+		}
+
+		delay := opts.Delay
+		if opts.Percentile > 0 {
+			if d, ok := latencies.percentile(opts.Percentile); ok {
+				delay = d
+			}
+		}
+
+		// cancels the losing calls once a result is returned
+		callCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// buffered, so that the losing calls do not leak their goroutines
+		results := make(chan result, opts.MaxHedges+1)
+		launch := func() {
+			go func() {
+				start := opts.Clock.Now()
+				value, err := e(callCtx)
+				results <- result{value: value, err: err, latency: opts.Clock.Now().Sub(start)}
+			}()
+		}
+
+		launch()
+		inflight, hedges := 1, uint(0)
+
+		var next <-chan time.Time
+		if opts.MaxHedges > 0 {
+			next = opts.Clock.After(delay)
+		}
+
+		var errs []error
+		for {
+			select {
+			case r := <-results:
+				inflight--
+				if r.err == nil {
+					latencies.add(r.latency)
+					return r.value, nil
+				}
+
+				errs = append(errs, r.err)
+				// hedges only cover slow calls, failures are left to retries
+				if inflight == 0 {
+					return zero, errors.Join(errs...)
+				}
+			case <-next:
+				launch()
+				inflight++
+				hedges++
+
+				next = nil
+				if hedges < opts.MaxHedges {
+					next = opts.Clock.After(delay)
+				}
+			case <-ctx.Done():
+				return zero, ctx.Err()
+			}
+		}
+	}
+}
+
+// latencies keeps the most recent call latencies in a ring buffer
+type latencies struct {
+	m       sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencies(size int) *latencies {
+	return &latencies{samples: make([]time.Duration, size)}
+}
+
+func (l *latencies) add(d time.Duration) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % len(l.samples)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// percentile returns the p-th percentile of the recorded latencies, or false
+// if too few latencies have been recorded
+func (l *latencies) percentile(p float64) (time.Duration, bool) {
+	l.m.Lock()
+	n := l.next
+	if l.full {
+		n = len(l.samples)
+	}
+	sorted := slices.Clone(l.samples[:n])
+	l.m.Unlock()
+
+	if n < min(minSamples, len(l.samples)) {
+		return 0, false
+	}
+
+	slices.Sort(sorted)
+	// nearest-rank percentile
+	rank := int(p*float64(n)+0.5) - 1
+	return sorted[max(0, min(rank, n-1))], true
+}
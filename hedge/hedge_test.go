@@ -0,0 +1,196 @@
+package hedge
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"patterns/clock"
+)
+
+var errFailure = errors.New("fail")
+
+func TestHedge(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var calls atomic.Int32
+	cancelled := make(chan struct{})
+	eff := HedgeWithClock(func(ctx context.Context) (string, error) {
+		// the first call hangs, while the hedge answers right away
+		if calls.Add(1) == 1 {
+			<-ctx.Done()
+			close(cancelled)
+			return "", ctx.Err()
+		}
+		return "hedge", nil
+	}, time.Second, 1, clk)
+
+	done := make(chan struct{})
+	var res string
+	var err error
+	go func() {
+		res, err = eff(context.Background())
+		close(done)
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	<-done
+
+	if err != nil {
+		t.Errorf("Expected no error - got '%s'", err)
+	} else if res != "hedge" {
+		t.Errorf("Expected 'hedge' - got '%s'", res)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("Expected the losing call to be cancelled")
+	}
+}
+
+func TestHedgeResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+		calls    int32
+	}{
+		{"Fast calls are not hedged", nil, "OK", 1},
+		{"Failed calls are not hedged", errFailure, "", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+			var calls atomic.Int32
+			eff := HedgeWithClock(func(ctx context.Context) (string, error) {
+				calls.Add(1)
+				if tt.err != nil {
+					return "", tt.err
+				}
+				return "OK", nil
+			}, time.Second, 3, clk)
+
+			res, err := eff(context.Background())
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Expected error '%s' - got '%s'", tt.err, err)
+			} else if res != tt.expected {
+				t.Errorf("Expected '%s' - got '%s'", tt.expected, res)
+			}
+			if n := calls.Load(); n != tt.calls {
+				t.Errorf("Expected %d calls - got %d", tt.calls, n)
+			}
+		})
+	}
+}
+
+func TestHedgeMaxHedges(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	started := make(chan struct{}, 10)
+	eff := HedgeWithClock(func(ctx context.Context) (string, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, time.Second, 2, clk)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := eff(ctx)
+		done <- err
+	}()
+
+	// every hedge waits for its own delay
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+	}
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	// no more hedges are scheduled
+	clk.Advance(time.Hour)
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error '%s' - got '%s'", context.Canceled, err)
+	}
+	if n := len(started); n != 0 {
+		t.Errorf("Expected 3 calls - got %d", 3+n)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		name     string
+		samples  int
+		p        float64
+		expected time.Duration
+		ok       bool
+	}{
+		{"Too few samples", 5, 0.5, 0, false},
+		{"Median", 100, 0.5, 50 * time.Millisecond, true},
+		{"95th percentile", 100, 0.95, 95 * time.Millisecond, true},
+		{"Only the last samples count", 150, 0.5, 100 * time.Millisecond, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newLatencies(100)
+			for i := 1; i <= tt.samples; i++ {
+				l.add(time.Duration(i) * time.Millisecond)
+			}
+
+			d, ok := l.percentile(tt.p)
+			if ok != tt.ok {
+				t.Errorf("Expected ok to be %v - got %v", tt.ok, ok)
+			} else if d != tt.expected {
+				t.Errorf("Expected %v - got %v", tt.expected, d)
+			}
+		})
+	}
+}
+
+func TestHedgePercentile(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	var calls atomic.Int32
+	eff := HedgeWithOptions(func(ctx context.Context) (string, error) {
+		switch n := calls.Add(1); {
+		case n <= minSamples:
+			// instant calls teach a zero delay
+			return "OK", nil
+		case n == minSamples+1:
+			<-ctx.Done()
+			return "", ctx.Err()
+		default:
+			return "hedge", nil
+		}
+	}, Options{Delay: time.Hour, Percentile: 0.9, MaxHedges: 1, Clock: clk})
+
+	for i := 0; i < minSamples; i++ {
+		if _, err := eff(context.Background()); err != nil {
+			t.Fatalf("Expected no error - got '%s'", err)
+		}
+	}
+
+	// the hedge is launched right away, rather than after Delay
+	done := make(chan string)
+	go func() {
+		res, _ := eff(context.Background())
+		done <- res
+	}()
+	select {
+	case res := <-done:
+		if res != "hedge" {
+			t.Errorf("Expected 'hedge' - got '%s'", res)
+		}
+	case <-time.After(time.Second):
+		t.Error("Expected the call to be hedged without waiting for Delay")
+	}
+}
@@ -0,0 +1,249 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"patterns/backoff"
+	circuitbreaker "patterns/circuit_breaker"
+	"patterns/clock"
+	"patterns/debounce"
+	"patterns/retry"
+	"patterns/stability"
+	"patterns/throttle"
+	"patterns/timeout"
+)
+
+// Effector is a function interacting with a service
+type Effector[T any] = stability.Effector[T]
+
+// Builder collects the stability patterns making up a Pipeline.
+//
+// Patterns can be added in any order: Build always composes them, from the
+// outermost to the innermost, as debounce, retry, throttle, circuit breaker
+// and timeout. This way every retry attempt consumes a throttling token and
+// goes through the breaker, while timed out attempts count as failures
+type Builder[T any] struct {
+	debounce *time.Duration
+	retry    *retrySettings
+	throttle *throttleSettings
+	breaker  *circuitbreaker.Settings
+	timeout  *time.Duration
+	clock    clock.Clock
+	errs     []error
+}
+
+type retrySettings struct {
+	retries int
+	delay   time.Duration
+}
+
+type throttleSettings struct {
+	max    uint
+	refill uint
+	d      time.Duration
+}
+
+// New creates an empty Builder
+func New[T any]() *Builder[T] {
+	return &Builder[T]{}
+}
+
+// Debounce collapses clusters of calls to the same Effector happening
+// within d into a single one, see debounce.DebounceFirst
+func (b *Builder[T]) Debounce(d time.Duration) *Builder[T] {
+	if b.debounce != nil {
+		b.errs = append(b.errs, errors.New("debounce configured twice"))
+	}
+	if d <= 0 {
+		b.errs = append(b.errs, fmt.Errorf("debounce duration must be positive - got %v", d))
+	}
+
+	b.debounce = &d
+	return b
+}
+
+// Retry retries failed calls up to retries times, waiting delay between
+// each attempt, see retry.Retry. Calls rejected by the circuit breaker
+// or by throttling are not retried
+func (b *Builder[T]) Retry(retries int, delay time.Duration) *Builder[T] {
+	if b.retry != nil {
+		b.errs = append(b.errs, errors.New("retry configured twice"))
+	}
+	if retries < 0 {
+		b.errs = append(b.errs, fmt.Errorf("retries must not be negative - got %d", retries))
+	}
+	if delay < 0 {
+		b.errs = append(b.errs, fmt.Errorf("retry delay must not be negative - got %v", delay))
+	}
+
+	b.retry = &retrySettings{retries: retries, delay: delay}
+	return b
+}
+
+// Throttle limits the rate of calls with a bucket of max tokens, refilled
+// by refill tokens every d, see throttle.Throttle
+func (b *Builder[T]) Throttle(max uint, refill uint, d time.Duration) *Builder[T] {
+	if b.throttle != nil {
+		b.errs = append(b.errs, errors.New("throttle configured twice"))
+	}
+	if max == 0 {
+		b.errs = append(b.errs, errors.New("throttle bucket size must be positive"))
+	}
+	if d <= 0 {
+		b.errs = append(b.errs, fmt.Errorf("throttle refill interval must be positive - got %v", d))
+	}
+
+	b.throttle = &throttleSettings{max: max, refill: refill, d: d}
+	return b
+}
+
+// CircuitBreaker protects the upstream service with a CircuitBreaker
+// configured by the given Settings
+func (b *Builder[T]) CircuitBreaker(s circuitbreaker.Settings) *Builder[T] {
+	if b.breaker != nil {
+		b.errs = append(b.errs, errors.New("circuit breaker configured twice"))
+	}
+
+	b.breaker = &s
+	return b
+}
+
+// Timeout gives every attempt at most d to complete, see timeout.Limit
+func (b *Builder[T]) Timeout(d time.Duration) *Builder[T] {
+	if b.timeout != nil {
+		b.errs = append(b.errs, errors.New("timeout configured twice"))
+	}
+	if d <= 0 {
+		b.errs = append(b.errs, fmt.Errorf("timeout must be positive - got %v", d))
+	}
+
+	b.timeout = &d
+	return b
+}
+
+// Clock sets the Clock used by every time-based pattern, including
+// the circuit breaker unless its Settings specify one
+func (b *Builder[T]) Clock(clk clock.Clock) *Builder[T] {
+	if clk == nil {
+		b.errs = append(b.errs, errors.New("clock must not be nil"))
+	}
+
+	b.clock = clk
+	return b
+}
+
+// Build validates the configured patterns and creates a Pipeline
+func (b *Builder[T]) Build() (*Pipeline[T], error) {
+	if len(b.errs) > 0 {
+		return nil, errors.Join(b.errs...)
+	}
+
+	p := &Pipeline[T]{
+		debounce: b.debounce,
+		retry:    b.retry,
+		timeout:  b.timeout,
+		clock:    b.clock,
+	}
+	if p.clock == nil {
+		p.clock = clock.Real()
+	}
+	if b.throttle != nil {
+		// throttling a no-op lets every wrapped Effector share the same bucket
+		p.throttle = throttle.ThrottleWithClock(func(ctx context.Context) (struct{}, error) {
+			return struct{}{}, nil
+		}, b.throttle.max, b.throttle.refill, b.throttle.d, p.clock)
+	}
+	if b.breaker != nil {
+		s := *b.breaker
+		if s.Clock == nil {
+			s.Clock = p.clock
+		}
+		p.breaker = circuitbreaker.NewCircuitBreaker[T](s)
+	}
+
+	return p, nil
+}
+
+// Pipeline composes several stability patterns into a single policy,
+// which can be applied to any number of Effectors.
+//
+// Throttling tokens and the circuit breaker state are shared by every
+// Effector wrapped by the same Pipeline, while debouncing applies
+// to each Effector on its own
+type Pipeline[T any] struct {
+	debounce *time.Duration
+	retry    *retrySettings
+	throttle Effector[struct{}]
+	breaker  *circuitbreaker.CircuitBreaker[T]
+	timeout  *time.Duration
+	clock    clock.Clock
+}
+
+// CircuitBreaker returns the CircuitBreaker shared by the Pipeline,
+// or nil if none was configured
+func (p *Pipeline[T]) CircuitBreaker() *circuitbreaker.CircuitBreaker[T] {
+	return p.breaker
+}
+
+// Wrap applies the Pipeline to the given Effector
+func (p *Pipeline[T]) Wrap(e Effector[T]) Effector[T] {
+	e = p.wrap(e)
+	if p.debounce != nil {
+		e = debounce.DebounceFirstWithClock(e, *p.debounce, p.clock)
+	}
+
+	return e
+}
+
+// Execute applies the Pipeline to the given Effector and calls it once.
+//
+// Debouncing is skipped, as it only applies across the calls to the same
+// Effector returned by Wrap
+func (p *Pipeline[T]) Execute(ctx context.Context, e Effector[T]) (T, error) {
+	return p.wrap(e)(ctx)
+}
+
+// wrap applies every pattern but debouncing to the given Effector
+func (p *Pipeline[T]) wrap(e Effector[T]) Effector[T] {
+	if p.timeout != nil {
+		e = timeout.LimitWithClock(e, *p.timeout, p.clock)
+	}
+	if p.breaker != nil {
+		e = p.wrapBreaker(e)
+	}
+	if p.throttle != nil {
+		e = p.wrapThrottle(e)
+	}
+	if p.retry != nil {
+		e = retry.RetryWithOptions(e, retry.Options{
+			Retries: p.retry.retries,
+			Backoff: backoff.Constant(p.retry.delay),
+			Clock:   p.clock,
+			// rejected calls would only be rejected again
+			RetryIf: func(err error) bool {
+				return !errors.Is(err, circuitbreaker.ErrOpenState) && !errors.Is(err, throttle.ErrThrottled)
+			},
+		})
+	}
+
+	return e
+}
+
+func (p *Pipeline[T]) wrapBreaker(e Effector[T]) Effector[T] {
+	return func(ctx context.Context) (T, error) {
+		return p.breaker.Execute(ctx, e)
+	}
+}
+
+func (p *Pipeline[T]) wrapThrottle(e Effector[T]) Effector[T] {
+	return func(ctx context.Context) (T, error) {
+		if _, err := p.throttle(ctx); err != nil {
+			var zero T
+			return zero, err
+		}
+		return e(ctx)
+	}
+}
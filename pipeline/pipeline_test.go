@@ -0,0 +1,127 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	circuitbreaker "patterns/circuit_breaker"
+	"patterns/throttle"
+)
+
+var errFailedService = errors.New("something went wrong")
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder[string]
+		valid   bool
+	}{
+		{"empty pipeline", New[string](), true},
+		{"every pattern", New[string]().Timeout(time.Second).Retry(3, time.Second).
+			CircuitBreaker(circuitbreaker.Settings{}).Throttle(10, 1, time.Second).Debounce(time.Second), true},
+		{"negative retries", New[string]().Retry(-1, time.Second), false},
+		{"zero timeout", New[string]().Timeout(0), false},
+		{"empty throttle bucket", New[string]().Throttle(0, 1, time.Second), false},
+		{"zero debounce", New[string]().Debounce(0), false},
+		{"nil clock", New[string]().Clock(nil), false},
+		{"pattern configured twice", New[string]().Timeout(time.Second).Timeout(2 * time.Second), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := tt.builder.Build()
+			if tt.valid && err != nil {
+				t.Errorf("Expected no error - got %v", err)
+			}
+			if !tt.valid && (err == nil || p != nil) {
+				t.Errorf("Expected a validation error - got %v", err)
+			}
+		})
+	}
+}
+
+func TestPipelineOrder(t *testing.T) {
+	p, err := New[string]().
+		Timeout(50*time.Millisecond).
+		CircuitBreaker(circuitbreaker.Settings{Threshold: 1, Timeout: time.Minute}).
+		Retry(3, time.Millisecond).
+		Build()
+	if err != nil {
+		t.Fatalf("Expected no error - got %v", err)
+	}
+
+	var calls atomic.Int32
+	hanging := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	// the timeouts trip the breaker, which rejects the remaining retries
+	_, err = p.Execute(context.Background(), hanging)
+	if !errors.Is(err, circuitbreaker.ErrOpenState) {
+		t.Errorf("Expected error %v - got %v", circuitbreaker.ErrOpenState, err)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected 2 calls before tripping - got %d", n)
+	}
+
+	// the breaker is shared with every other wrapped Effector
+	working := p.Wrap(func(ctx context.Context) (string, error) { return "OK", nil })
+	if _, err := working(context.Background()); !errors.Is(err, circuitbreaker.ErrOpenState) {
+		t.Errorf("Expected error %v - got %v", circuitbreaker.ErrOpenState, err)
+	}
+	if state := p.CircuitBreaker().State(); state != circuitbreaker.StateOpen {
+		t.Errorf("Expected breaker to be %s - got %s", circuitbreaker.StateOpen, state)
+	}
+}
+
+func TestPipelineThrottle(t *testing.T) {
+	p, err := New[string]().Throttle(2, 1, time.Minute).Build()
+	if err != nil {
+		t.Fatalf("Expected no error - got %v", err)
+	}
+
+	first := p.Wrap(func(ctx context.Context) (string, error) { return "OK", nil })
+	second := p.Wrap(func(ctx context.Context) (string, error) { return "OK", nil })
+
+	for _, e := range []Effector[string]{first, second} {
+		if _, err := e(context.Background()); err != nil {
+			t.Errorf("Expected no error - got %v", err)
+		}
+	}
+	// the bucket is shared, so it is already empty
+	if _, err := first(context.Background()); !errors.Is(err, throttle.ErrThrottled) {
+		t.Errorf("Expected error %v - got %v", throttle.ErrThrottled, err)
+	}
+}
+
+func TestPipelineThrottleRetry(t *testing.T) {
+	p, err := New[string]().Throttle(1, 1, time.Minute).Retry(3, time.Minute).Build()
+	if err != nil {
+		t.Fatalf("Expected no error - got %v", err)
+	}
+
+	var calls atomic.Int32
+	working := func(ctx context.Context) (string, error) {
+		calls.Add(1)
+		return "OK", nil
+	}
+	if _, err := p.Execute(context.Background(), working); err != nil {
+		t.Fatalf("Expected no error - got %v", err)
+	}
+
+	// the throttled call is not retried, so it does not wait for the next token
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = p.Execute(ctx, working)
+	if !errors.Is(err, throttle.ErrThrottled) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected error %v - got %v", throttle.ErrThrottled, err)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected 1 call - got %d", n)
+	}
+}
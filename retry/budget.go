@@ -0,0 +1,107 @@
+package retry
+
+import (
+	"sync"
+	"time"
+
+	"patterns/clock"
+)
+
+const budgetBuckets = 10
+
+// Budget limits the extra load retries put on a service, and can be
+// shared by any number of Effectors calling it.
+//
+// Every call deposits into the Budget and every retry withdraws from it:
+// retries are allowed as long as they do not exceed the given ratio of the
+// calls made during the last ttl, plus a minimum number of retries per second
+// which keeps low traffic services retrying
+type Budget struct {
+	ratio        float64
+	minPerSecond uint
+	ttl          time.Duration
+	width        time.Duration
+	clock        clock.Clock
+
+	m       sync.Mutex
+	buckets []budgetBucket
+}
+
+// budgetBucket counts the calls and retries made during one slice of the ttl
+type budgetBucket struct {
+	epoch   int64
+	calls   uint
+	retries uint
+}
+
+// NewBudget creates a Budget allowing retries to add at most ratio extra load,
+// e.g. 0.2 for 20%, but at least minPerSecond retries per second, computed
+// over the last ttl
+func NewBudget(ratio float64, minPerSecond uint, ttl time.Duration) *Budget {
+	return NewBudgetWithClock(ratio, minPerSecond, ttl, clock.Real())
+}
+
+// NewBudgetWithClock is like NewBudget, but measures ttl using the given Clock
+func NewBudgetWithClock(ratio float64, minPerSecond uint, ttl time.Duration, clk clock.Clock) *Budget {
+	width := ttl / budgetBuckets
+	if width <= 0 {
+		width = 1
+	}
+
+	return &Budget{
+		ratio:        ratio,
+		minPerSecond: minPerSecond,
+		ttl:          ttl,
+		width:        width,
+		clock:        clk,
+		buckets:      make([]budgetBucket, budgetBuckets),
+	}
+}
+
+// Deposit records a call, making room for more retries
+func (b *Budget) Deposit() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.bucket(b.clock.Now()).calls++
+}
+
+// Withdraw reports whether a retry is allowed, recording it if so
+func (b *Budget) Withdraw() bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	now := b.clock.Now()
+	epoch := b.epoch(now)
+
+	var calls, retries uint
+	for _, bb := range b.buckets {
+		if age := epoch - bb.epoch; age >= 0 && age < int64(len(b.buckets)) {
+			calls += bb.calls
+			retries += bb.retries
+		}
+	}
+
+	allowed := float64(b.minPerSecond)*b.ttl.Seconds() + b.ratio*float64(calls)
+	if float64(retries)+1 > allowed {
+		return false
+	}
+
+	b.bucket(now).retries++
+	return true
+}
+
+func (b *Budget) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(b.width)
+}
+
+// bucket returns the bucket for the current slice, clearing it if it
+// still holds counts from an older one
+func (b *Budget) bucket(now time.Time) *budgetBucket {
+	epoch := b.epoch(now)
+	bb := &b.buckets[epoch%int64(len(b.buckets))]
+	if bb.epoch != epoch {
+		*bb = budgetBucket{epoch: epoch}
+	}
+	return bb
+}
@@ -0,0 +1,88 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"patterns/clock"
+)
+
+func TestBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		ratio        float64
+		minPerSecond uint
+		calls        int
+		allowed      int
+	}{
+		{"No calls and no minimum", 0.2, 0, 0, 0},
+		{"Retries limited by ratio", 0.2, 0, 10, 2},
+		{"Retries limited by minimum", 0.2, 1, 0, 10},
+		{"Ratio and minimum add up", 0.5, 1, 10, 15},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+			b := NewBudgetWithClock(tt.ratio, tt.minPerSecond, 10*time.Second, clk)
+			for i := 0; i < tt.calls; i++ {
+				b.Deposit()
+			}
+
+			allowed := 0
+			for b.Withdraw() {
+				allowed++
+			}
+			if allowed != tt.allowed {
+				t.Errorf("Expected %d retries - got %d", tt.allowed, allowed)
+			}
+		})
+	}
+}
+
+func TestBudgetExpiry(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := NewBudgetWithClock(0.5, 0, 10*time.Second, clk)
+
+	for i := 0; i < 4; i++ {
+		b.Deposit()
+	}
+	if !b.Withdraw() || !b.Withdraw() {
+		t.Fatal("Expected 2 retries to be allowed")
+	}
+	if b.Withdraw() {
+		t.Fatal("Expected the budget to be exhausted")
+	}
+
+	// calls and retries expire together
+	clk.Advance(10 * time.Second)
+	b.Deposit()
+	b.Deposit()
+	if !b.Withdraw() {
+		t.Error("Expected a retry to be allowed after the ttl")
+	}
+	if b.Withdraw() {
+		t.Error("Expected expired calls not to count")
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	budget := NewBudgetWithClock(0, 1, time.Second, clk)
+
+	attempts := 0
+	eff := RetryWithOptions(func(ctx context.Context) (string, error) {
+		attempts++
+		return "", errTransientFailure
+	}, Options{Retries: 3, Clock: clk, Budget: budget})
+
+	if _, err := eff(context.Background()); !errors.Is(err, errTransientFailure) {
+		t.Errorf("Expected error '%s' - got '%s'", errTransientFailure, err)
+	}
+	// a single retry per second is allowed
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts - got %d", attempts)
+	}
+}
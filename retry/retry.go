@@ -2,32 +2,191 @@ package retry
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"time"
+
+	"patterns/backoff"
+	"patterns/clock"
+	"patterns/stability"
+	"patterns/timeout"
 )
 
 // Effector is a function interacting with a service
-type Effector func(ctx context.Context) (string, error)
+type Effector[T any] = stability.Effector[T]
+
+// Options configures the retry logic applied by RetryWithOptions
+type Options struct {
+	// Retries is the maximum number of retry attempts
+	Retries int
+	// Backoff computes the interval before each retry attempt, see the backoff
+	// package for exponential and jittered strategies. Defaults to no interval
+	Backoff backoff.Strategy
+	// Clock is used to wait between attempts. Defaults to clock.Real()
+	Clock clock.Clock
+	// RetryIf reports whether a failed attempt should be retried.
+	// Defaults to retrying every error, except those marked as Permanent
+	RetryIf func(error) bool
+	// Budget, when set, is consulted before every retry: once it is
+	// exhausted, the error of the last attempt is returned immediately
+	Budget *Budget
+	// OnRetry, when set, is called after every failed attempt which is
+	// going to be retried, with the attempt number starting from 1
+	OnRetry func(attempt int, err error, nextDelay time.Duration)
+	// Logger, when set, logs every failed attempt which is going to be retried
+	Logger *slog.Logger
+	// MaxRetryAfter, when positive, makes every retry wait the delay hinted by errors
+	// implementing RetryAfterError, capped at MaxRetryAfter. Hints are ignored otherwise
+	MaxRetryAfter time.Duration
+	// MaxElapsed bounds the total time spent across all attempts: no retry
+	// is made once waiting for it would exceed MaxElapsed. Not bounded when not positive
+	MaxElapsed time.Duration
+	// AttemptTimeout, when positive, gives every attempt at most AttemptTimeout
+	// to complete, see timeout.Limit
+	AttemptTimeout time.Duration
+}
+
+// PermanentError marks an error which should not be retried
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the original error
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps err so that Retry stops immediately, returning err itself
+// to the caller. An Effector returns it for errors which will never succeed,
+// such as validation errors
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// retryable reports whether the given error should be retried, stripping
+// the PermanentError wrapper from errors which should not
+func (opts Options) retryable(err error) (bool, error) {
+	if p, ok := err.(*PermanentError); ok {
+		return false, p.Err
+	}
+
+	var p *PermanentError
+	if errors.As(err, &p) {
+		return false, err
+	}
+	if opts.RetryIf != nil && !opts.RetryIf(err) {
+		return false, err
+	}
+	return true, err
+}
 
 // Retry wraps an Effector function to provide retry logic.
 
 // Accepts an int describing the maximum number of retry attempts and
 // a time.Duration describing the interval between each retry attempt
-func Retry(effector Effector, retries int, delay time.Duration) Effector {
-	return func(ctx context.Context) (string, error) {
+func Retry[T any](effector Effector[T], retries int, delay time.Duration) Effector[T] {
+	return RetryWithOptions(effector, Options{
+		Retries: retries,
+		Backoff: backoff.Constant(delay),
+		Logger:  slog.Default(),
+	})
+}
+
+// RetryWithClock is like Retry, but waits between attempts using the given Clock
+func RetryWithClock[T any](effector Effector[T], retries int, delay time.Duration, clk clock.Clock) Effector[T] {
+	return RetryWithOptions(effector, Options{
+		Retries: retries,
+		Backoff: backoff.Constant(delay),
+		Clock:   clk,
+		Logger:  slog.Default(),
+	})
+}
+
+// RetryWithOptions wraps an Effector function to provide retry logic configured by the given Options.
+//
+// When more than one attempt fails, the returned error joins the errors
+// of every attempt, so that errors.Is and errors.As can inspect each of them
+func RetryWithOptions[T any](effector Effector[T], opts Options) Effector[T] {
+	if opts.Backoff == nil {
+		opts.Backoff = backoff.Constant(0)
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	if opts.AttemptTimeout > 0 {
+		effector = timeout.LimitWithClock(effector, opts.AttemptTimeout, opts.Clock)
+	}
+
+	return func(ctx context.Context) (T, error) {
+		if opts.Budget != nil {
+			opts.Budget.Deposit()
+		}
+
+		start := opts.Clock.Now()
+
+		var errs []error
+		var wait time.Duration
 		for r := 0; ; r++ {
 			response, err := effector(ctx)
-			if err == nil || r >= retries {
-				return response, err
+			if err == nil {
+				return response, nil
+			}
+
+			retryable, err := opts.retryable(err)
+			errs = append(errs, err)
+			if !retryable || r >= opts.Retries {
+				return response, join(errs)
 			}
 
-			log.Printf("Attempt %d failed; retrying in %v", r+1, delay)
+			wait = opts.Backoff(uint(r), wait)
+			delay := wait
+			// the hint only applies to this attempt, leaving the backoff unaffected
+			if hint, ok := retryAfter(err, opts.MaxRetryAfter); ok {
+				delay = hint
+			}
+			if opts.MaxElapsed > 0 && opts.Clock.Now().Sub(start)+delay > opts.MaxElapsed {
+				return response, join(errs)
+			}
+			if opts.Budget != nil && !opts.Budget.Withdraw() {
+				return response, join(errs)
+			}
+			opts.report(ctx, r+1, err, delay)
 
 			select {
-			case <-time.After(delay):
+			case <-opts.Clock.After(delay):
 			case <-ctx.Done():
-				return "", ctx.Err()
+				var zero T
+				return zero, join(append(errs, ctx.Err()))
 			}
 		}
 	}
 }
+
+// report notifies the OnRetry hook and the Logger of a failed attempt
+func (opts Options) report(ctx context.Context, attempt int, err error, wait time.Duration) {
+	if opts.OnRetry != nil {
+		opts.OnRetry(attempt, err, wait)
+	}
+	if opts.Logger != nil {
+		opts.Logger.WarnContext(ctx, "attempt failed; retrying",
+			slog.Int("attempt", attempt),
+			slog.Any("error", err),
+			slog.Duration("delay", wait),
+		)
+	}
+}
+
+// join returns the only error of a single failed attempt as it is
+func join(errs []error) error {
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
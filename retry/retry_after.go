@@ -0,0 +1,71 @@
+package retry
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryAfterError is implemented by errors carrying a hint from the service
+// about when it should be called again, such as an HTTP Retry-After header.
+//
+// When Options.MaxRetryAfter is set and RetryWithOptions gets one of them,
+// it waits the hinted delay instead of the one computed by the backoff Strategy
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+// retryAfter returns the delay hinted by err, if any, capped at max.
+// Hints are ignored when max is not positive
+func retryAfter(err error, max time.Duration) (time.Duration, bool) {
+	if max <= 0 {
+		return 0, false
+	}
+
+	var hint RetryAfterError
+	if !errors.As(err, &hint) {
+		return 0, false
+	}
+
+	d := hint.RetryAfter()
+	if d <= 0 {
+		return 0, false
+	}
+	return min(d, max), true
+}
+
+// ResponseRetryAfter extracts the delay requested by the Retry-After header of the given response,
+// given either in seconds or as an HTTP date. It reports false if there is no valid header
+func ResponseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+
+	// measure dates against the server clock, when available, to avoid skew
+	now := time.Now()
+	if date, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+		now = date
+	}
+	return parseRetryAfter(resp.Header.Get("Retry-After"), now)
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	at, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	// a date in the past means the service can be called right away
+	return max(at.Sub(now), 0), true
+}
@@ -0,0 +1,113 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"patterns/backoff"
+	"patterns/clock"
+)
+
+type hintError time.Duration
+
+func (e hintError) Error() string {
+	return "come back later"
+}
+
+func (e hintError) RetryAfter() time.Duration {
+	return time.Duration(e)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"Missing", "", 0, false},
+		{"Seconds", "120", 2 * time.Minute, true},
+		{"Zero seconds", "0", 0, true},
+		{"Negative seconds", "-5", 0, false},
+		{"Date", "Sun, 01 Jan 2023 00:00:30 GMT", 30 * time.Second, true},
+		{"Past date", "Sat, 31 Dec 2022 23:59:00 GMT", 0, true},
+		{"Invalid", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := parseRetryAfter(tt.value, now)
+			if ok != tt.ok {
+				t.Errorf("Expected ok to be %v - got %v", tt.ok, ok)
+			} else if d != tt.expected {
+				t.Errorf("Expected %v - got %v", tt.expected, d)
+			}
+		})
+	}
+}
+
+func TestResponseRetryAfter(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+	resp.Header.Set("Date", "Sun, 01 Jan 2023 00:00:00 GMT")
+	resp.Header.Set("Retry-After", "Sun, 01 Jan 2023 00:01:00 GMT")
+
+	if d, ok := ResponseRetryAfter(resp); !ok || d != time.Minute {
+		t.Errorf("Expected %v - got %v", time.Minute, d)
+	}
+	if _, ok := ResponseRetryAfter(nil); ok {
+		t.Error("Expected no delay for a nil response")
+	}
+}
+
+func TestRetryAfterHint(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		max      time.Duration
+		expected time.Duration
+	}{
+		{"No hint", errTransientFailure, time.Minute, time.Second},
+		{"Hints are ignored without a maximum", hintError(30 * time.Second), 0, time.Second},
+		{"Hint overrides the backoff", hintError(30 * time.Second), time.Minute, 30 * time.Second},
+		{"Wrapped hint", errors.Join(errTransientFailure, hintError(5*time.Second)), time.Minute, 5 * time.Second},
+		{"Hint capped", hintError(time.Hour), time.Minute, time.Minute},
+		{"Empty hint", hintError(0), time.Minute, time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+			var delay time.Duration
+			eff := RetryWithOptions(func(ctx context.Context) (string, error) {
+				return "", tt.err
+			}, Options{
+				Retries:       1,
+				Backoff:       backoff.Constant(time.Second),
+				Clock:         clk,
+				MaxRetryAfter: tt.max,
+				OnRetry: func(attempt int, err error, nextDelay time.Duration) {
+					delay = nextDelay
+				},
+			})
+
+			done := make(chan struct{})
+			go func() {
+				eff(context.Background())
+				close(done)
+			}()
+			clk.BlockUntil(1)
+			clk.Advance(tt.expected)
+			<-done
+
+			if delay != tt.expected {
+				t.Errorf("Expected a %v delay - got %v", tt.expected, delay)
+			}
+		})
+	}
+}
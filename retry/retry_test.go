@@ -1,10 +1,17 @@
 package retry
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
 	"testing"
 	"time"
+
+	"patterns/backoff"
+	"patterns/clock"
 )
 
 var errTransientFailure = errors.New("fail")
@@ -41,7 +48,7 @@ func TestRetry(t *testing.T) {
 			go func() { time.Sleep(tt.wait * time.Second); cancel() }()
 
 			res, err := eff(ctx)
-			if err != tt.err {
+			if !errors.Is(err, tt.err) {
 				t.Errorf("Expected error '%s' - got '%s'", tt.err, err)
 			} else if res != tt.expected {
 				t.Errorf("Expected '%s' - got '%s'", tt.expected, res)
@@ -49,3 +56,218 @@ func TestRetry(t *testing.T) {
 		})
 	}
 }
+
+func TestRetryWithClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	count = 0
+	eff := RetryWithClock(EmulateTransientError, 4, time.Minute, clk)
+
+	done := make(chan struct{})
+	var res string
+	var err error
+	go func() {
+		res, err = eff(context.Background())
+		close(done)
+	}()
+
+	// every failed attempt waits a full minute on the clock
+	for i := 0; i < 3; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+	}
+	<-done
+
+	if err != nil {
+		t.Errorf("Expected no error - got '%s'", err)
+	} else if res != "OK" {
+		t.Errorf("Expected 'OK' - got '%s'", res)
+	}
+}
+
+func TestRetryWithOptions(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	var attempts []time.Duration
+	eff := RetryWithOptions(func(ctx context.Context) (string, error) {
+		attempts = append(attempts, clk.Now().Sub(start))
+		return "", errTransientFailure
+	}, Options{
+		Retries: 3,
+		Backoff: backoff.Exponential(time.Minute, 3*time.Minute),
+		Clock:   clk,
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := eff(context.Background())
+		done <- err
+	}()
+
+	// advance a second at a time, so that early attempts would be noticed
+	for i := 0; i < 6*60; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Second)
+	}
+
+	if err := <-done; !errors.Is(err, errTransientFailure) {
+		t.Errorf("Expected error '%s' - got '%s'", errTransientFailure, err)
+	}
+	expected := []time.Duration{0, time.Minute, 3 * time.Minute, 6 * time.Minute}
+	if len(attempts) != len(expected) {
+		t.Fatalf("Expected attempts at %v - got %v", expected, attempts)
+	}
+	for i := range expected {
+		if attempts[i] != expected[i] {
+			t.Errorf("Expected attempt %d at %v - got %v", i+1, expected[i], attempts[i])
+		}
+	}
+}
+
+func TestRetryPermanent(t *testing.T) {
+	errInvalid := errors.New("invalid request")
+
+	tests := []struct {
+		name     string
+		err      error
+		retryIf  func(error) bool
+		attempts int
+		expected error
+	}{
+		{"Transient errors are retried", errTransientFailure, nil, 4, errTransientFailure},
+		{"Permanent errors are not retried", Permanent(errInvalid), nil, 1, errInvalid},
+		{"RetryIf rejects the error", errInvalid, func(err error) bool { return err != errInvalid }, 1, errInvalid},
+		{"RetryIf accepts the error", errTransientFailure, func(err error) bool { return err != errInvalid }, 4, errTransientFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			eff := RetryWithOptions(func(ctx context.Context) (string, error) {
+				attempts++
+				return "", tt.err
+			}, Options{Retries: 3, RetryIf: tt.retryIf})
+
+			_, err := eff(context.Background())
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected error '%s' - got '%s'", tt.expected, err)
+			}
+			if attempts != tt.attempts {
+				t.Errorf("Expected %d attempts - got %d", tt.attempts, attempts)
+			}
+		})
+	}
+}
+
+func TestRetryReporting(t *testing.T) {
+	errs := []error{errors.New("first"), errors.New("second"), errors.New("third")}
+
+	attempts := 0
+	var reported []string
+	var logs bytes.Buffer
+	eff := RetryWithOptions(func(ctx context.Context) (string, error) {
+		attempts++
+		return "", errs[attempts-1]
+	}, Options{
+		Retries: 2,
+		OnRetry: func(attempt int, err error, nextDelay time.Duration) {
+			reported = append(reported, fmt.Sprintf("%d %s %v", attempt, err, nextDelay))
+		},
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+
+	_, err := eff(context.Background())
+	for _, e := range errs {
+		if !errors.Is(err, e) {
+			t.Errorf("Expected error '%s' to include '%s'", err, e)
+		}
+	}
+
+	expected := []string{"1 first 0s", "2 second 0s"}
+	if strings.Join(reported, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected retries %q - got %q", expected, reported)
+	}
+	if n := strings.Count(logs.String(), "attempt failed"); n != 2 {
+		t.Errorf("Expected 2 log lines - got %d: %s", n, logs.String())
+	}
+}
+
+func TestRetryMaxElapsed(t *testing.T) {
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	clk := clock.NewFake(start)
+
+	var attempts []time.Duration
+	eff := RetryWithOptions(func(ctx context.Context) (string, error) {
+		attempts = append(attempts, clk.Now().Sub(start))
+		return "", errTransientFailure
+	}, Options{
+		Retries:    10,
+		Backoff:    backoff.Constant(time.Minute),
+		Clock:      clk,
+		MaxElapsed: 150 * time.Second,
+	})
+
+	done := make(chan error)
+	go func() {
+		_, err := eff(context.Background())
+		done <- err
+	}()
+
+	// a third retry would start after the elapsed time budget
+	for i := 0; i < 2; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(time.Minute)
+	}
+
+	if err := <-done; !errors.Is(err, errTransientFailure) {
+		t.Errorf("Expected error '%s' - got '%s'", errTransientFailure, err)
+	}
+	expected := []time.Duration{0, time.Minute, 2 * time.Minute}
+	if fmt.Sprint(attempts) != fmt.Sprint(expected) {
+		t.Errorf("Expected attempts at %v - got %v", expected, attempts)
+	}
+}
+
+func TestRetryAttemptTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	// attempts hang until their own deadline, until the first one is retried
+	release := make(chan struct{})
+	var retried error
+	eff := RetryWithOptions(func(ctx context.Context) (string, error) {
+		select {
+		case <-release:
+			return "OK", nil
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}, Options{
+		Retries:        1,
+		Clock:          clk,
+		AttemptTimeout: time.Second,
+		OnRetry: func(attempt int, err error, nextDelay time.Duration) {
+			retried = err
+			close(release)
+		},
+	})
+
+	done := make(chan struct{})
+	var res string
+	var err error
+	go func() {
+		res, err = eff(context.Background())
+		close(done)
+	}()
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	<-done
+
+	if err != nil {
+		t.Errorf("Expected no error - got '%s'", err)
+	} else if res != "OK" {
+		t.Errorf("Expected 'OK' - got '%s'", res)
+	}
+	if !errors.Is(retried, context.DeadlineExceeded) {
+		t.Errorf("Expected the first attempt to time out - got '%s'", retried)
+	}
+}
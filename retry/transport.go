@@ -0,0 +1,146 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+)
+
+// maxDrain is the most of a discarded response body read to reuse its connection
+const maxDrain = 4 << 10
+
+// Transport is an http.RoundTripper retrying failed requests, which can be
+// dropped into any http.Client.
+//
+// Only requests which are safe to send again are retried: those with an idempotent
+// method, or an Idempotency-Key header, and a body which can be rewound through GetBody.
+// Both transport errors and responses with a retryable status code are retried;
+// once the retries are over, the last response is returned as it is.
+//
+// Options.AttemptTimeout is ignored, as it would also interrupt reading the
+// returned response body: use the timeouts of the Base RoundTripper instead
+type Transport struct {
+	// Base is the RoundTripper sending the requests. Defaults to http.DefaultTransport
+	Base http.RoundTripper
+	// Options configures the retry logic. Retry-After headers are honored
+	// as hints when Options.MaxRetryAfter is set
+	Options Options
+	// RetryStatus reports whether a response with the given status code should be retried.
+	// Defaults to retrying 429, 502, 503 and 504
+	RetryStatus func(code int) bool
+}
+
+// NewTransport creates a Transport sending requests through base, and retrying them according to opts
+func NewTransport(base http.RoundTripper, opts Options) *Transport {
+	return &Transport{Base: base, Options: opts}
+}
+
+// statusError reports a response whose status code should be retried
+type statusError struct {
+	resp *http.Response
+}
+
+func (e *statusError) Error() string {
+	return "unexpected status " + e.resp.Status
+}
+
+// RetryAfter returns the delay requested by the Retry-After header, if any
+func (e *statusError) RetryAfter() time.Duration {
+	d, _ := ResponseRetryAfter(e.resp)
+	return d
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !replayable(req) {
+		return base.RoundTrip(req)
+	}
+
+	retryStatus := t.RetryStatus
+	if retryStatus == nil {
+		retryStatus = DefaultRetryStatus
+	}
+
+	opts := t.Options
+	// abandoned attempts would leak their responses
+	opts.AttemptTimeout = 0
+	onRetry := opts.OnRetry
+	opts.OnRetry = func(attempt int, err error, nextDelay time.Duration) {
+		if onRetry != nil {
+			onRetry(attempt, err, nextDelay)
+		}
+		// the response is discarded, freeing its connection
+		var status *statusError
+		if errors.As(err, &status) {
+			drain(status.resp.Body)
+		}
+	}
+
+	attempt := 0
+	eff := RetryWithOptions(func(ctx context.Context) (*http.Response, error) {
+		r := req
+		// the original request is sent first, its copies after
+		if attempt++; attempt > 1 {
+			r = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, Permanent(err)
+				}
+				r.Body = body
+			}
+		}
+
+		resp, err := base.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		if retryStatus(resp.StatusCode) {
+			return resp, &statusError{resp: resp}
+		}
+		return resp, nil
+	}, opts)
+
+	resp, err := eff(req.Context())
+	// a response is only returned once the retries are over
+	if resp != nil {
+		return resp, nil
+	}
+	return nil, err
+}
+
+// DefaultRetryStatus reports whether a response status code means the request can be retried:
+// the service being overloaded, unavailable or too slow to answer its gateway
+func DefaultRetryStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// replayable reports whether the request can be safely sent more than once
+func replayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, key := req.Header["Idempotency-Key"]
+	_, xkey := req.Header["X-Idempotency-Key"]
+	return key || xkey
+}
+
+func drain(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, maxDrain))
+	body.Close()
+}
@@ -0,0 +1,179 @@
+package retry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// statusServer answers with the given status codes in turn, then with 200,
+// recording the body of every request
+func statusServer(t *testing.T, codes ...int) (*httptest.Server, func() []string) {
+	var m sync.Mutex
+	var bodies []string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		m.Lock()
+		n := len(bodies)
+		bodies = append(bodies, string(body))
+		m.Unlock()
+
+		code := http.StatusOK
+		if n < len(codes) {
+			code = codes[n]
+		}
+		if code == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "120")
+		}
+		w.WriteHeader(code)
+		io.WriteString(w, http.StatusText(code))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []string {
+		m.Lock()
+		defer m.Unlock()
+		return append([]string(nil), bodies...)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		header   string
+		codes    []int
+		expected int
+		requests int
+	}{
+		{"Retryable statuses", http.MethodGet, "", []int{502, 503, 504}, 200, 4},
+		{"Other statuses are not retried", http.MethodGet, "", []int{500}, 500, 1},
+		{"Last response returned", http.MethodGet, "", []int{503, 503, 503, 503, 503}, 503, 4},
+		{"Idempotent methods", http.MethodPut, "", []int{503}, 200, 2},
+		{"Non idempotent methods are not retried", http.MethodPost, "", []int{503}, 503, 1},
+		{"Idempotency key", http.MethodPost, "Idempotency-Key", []int{503}, 200, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, bodies := statusServer(t, tt.codes...)
+			client := &http.Client{Transport: NewTransport(nil, Options{Retries: 3})}
+
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader("payload"))
+			if tt.header != "" {
+				req.Header.Set(tt.header, "key")
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Expected no error - got '%s'", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.expected {
+				t.Errorf("Expected status %d - got %d", tt.expected, resp.StatusCode)
+			}
+			if body, _ := io.ReadAll(resp.Body); string(body) != http.StatusText(tt.expected) {
+				t.Errorf("Expected body '%s' - got '%s'", http.StatusText(tt.expected), body)
+			}
+
+			requests := bodies()
+			if len(requests) != tt.requests {
+				t.Errorf("Expected %d requests - got %d", tt.requests, len(requests))
+			}
+			// the body is sent again with every attempt
+			for i, body := range requests {
+				if body != "payload" {
+					t.Errorf("Expected request %d body 'payload' - got '%s'", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestTransportUnrewindableBody(t *testing.T) {
+	srv, bodies := statusServer(t, http.StatusServiceUnavailable)
+	client := &http.Client{Transport: NewTransport(nil, Options{Retries: 3})}
+
+	req, _ := http.NewRequest(http.MethodPut, srv.URL, io.NopCloser(strings.NewReader("payload")))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Expected no error - got '%s'", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d - got %d", http.StatusServiceUnavailable, resp.StatusCode)
+	}
+	if n := len(bodies()); n != 1 {
+		t.Errorf("Expected 1 request - got %d", n)
+	}
+}
+
+func TestTransportRetryAfter(t *testing.T) {
+	srv, _ := statusServer(t, http.StatusTooManyRequests)
+
+	var delay time.Duration
+	client := &http.Client{Transport: NewTransport(nil, Options{
+		Retries:       1,
+		MaxRetryAfter: 10 * time.Millisecond,
+		OnRetry: func(attempt int, err error, nextDelay time.Duration) {
+			delay = nextDelay
+		},
+	})}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected no error - got '%s'", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d - got %d", http.StatusOK, resp.StatusCode)
+	}
+	// the two minutes requested by the server are capped
+	if delay != 10*time.Millisecond {
+		t.Errorf("Expected a %v delay - got %v", 10*time.Millisecond, delay)
+	}
+}
+
+func TestTransportError(t *testing.T) {
+	srv, _ := statusServer(t)
+	srv.Close()
+
+	var attempts int
+	client := &http.Client{Transport: NewTransport(nil, Options{
+		Retries: 2,
+		OnRetry: func(attempt int, err error, nextDelay time.Duration) {
+			attempts = attempt
+		},
+	})}
+
+	if _, err := client.Get(srv.URL); err == nil {
+		t.Error("Expected an error - got none")
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 retries - got %d", attempts)
+	}
+}
+
+func TestTransportAttemptTimeout(t *testing.T) {
+	srv, _ := statusServer(t)
+	client := &http.Client{Transport: NewTransport(nil, Options{AttemptTimeout: time.Nanosecond})}
+
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Expected no error - got '%s'", err)
+	}
+	defer resp.Body.Close()
+
+	// the body is still readable once the attempt is over
+	if body, err := io.ReadAll(resp.Body); err != nil || string(body) != "OK" {
+		t.Errorf("Expected body 'OK' - got '%s' (%v)", body, err)
+	}
+}
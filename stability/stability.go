@@ -0,0 +1,10 @@
+package stability
+
+import "context"
+
+// Effector represents a function interacting with an upstream service
+// and returning a result of type T, or an error.
+//
+// Every stability pattern wraps and returns an Effector, so that
+// wrappers from different packages can be composed with each other
+type Effector[T any] func(context.Context) (T, error)
@@ -0,0 +1,39 @@
+package stability_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	circuitbreaker "patterns/circuit_breaker"
+	"patterns/debounce"
+	"patterns/retry"
+	"patterns/throttle"
+)
+
+type payload struct {
+	ID   int
+	Name string
+}
+
+func fetchPayload(ctx context.Context) (payload, error) {
+	return payload{ID: 1, Name: "OK"}, nil
+}
+
+func TestComposition(t *testing.T) {
+	e := retry.Retry(
+		circuitbreaker.Breaker(
+			throttle.Throttle(
+				debounce.DebounceFirst(fetchPayload, time.Second),
+				10, 1, time.Second),
+			3),
+		2, time.Millisecond)
+
+	res, err := e(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error - got %v", err)
+	}
+	if res.ID != 1 || res.Name != "OK" {
+		t.Errorf("Expected {1 OK} - got %+v", res)
+	}
+}
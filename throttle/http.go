@@ -0,0 +1,120 @@
+package throttle
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"patterns/clock"
+)
+
+// ThrottledError is returned by a Transport when a request is throttled
+type ThrottledError struct {
+	// Host the request was sent to
+	Host string
+	// Delay is the time left before the next refill, or zero if unknown
+	Delay time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("%s to %s", ErrThrottled, e.Host)
+}
+
+// Unwrap returns the error returned by throttled Effectors
+func (e *ThrottledError) Unwrap() error {
+	return ErrThrottled
+}
+
+// RetryAfter returns how long callers should wait before trying again
+func (e *ThrottledError) RetryAfter() time.Duration {
+	return e.Delay
+}
+
+// Transport is an http.RoundTripper limiting the rate of requests,
+// with a separate Bucket for every host
+type Transport struct {
+	base   http.RoundTripper
+	max    uint
+	refill uint
+	d      time.Duration
+	clock  clock.Clock
+
+	m       sync.Mutex
+	buckets map[string]*Bucket
+}
+
+// NewTransport creates a Transport sending requests through base, or http.DefaultTransport if nil.
+// Every host gets a bucket of max tokens, refilled by refill tokens every d
+func NewTransport(base http.RoundTripper, max uint, refill uint, d time.Duration) *Transport {
+	return NewTransportWithClock(base, max, refill, d, clock.Real())
+}
+
+// NewTransportWithClock is like NewTransport, but refills the buckets according to the given Clock
+func NewTransportWithClock(base http.RoundTripper, max uint, refill uint, d time.Duration, clk clock.Clock) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{
+		base:    base,
+		max:     max,
+		refill:  refill,
+		d:       d,
+		clock:   clk,
+		buckets: make(map[string]*Bucket),
+	}
+}
+
+// RoundTrip implements http.RoundTripper, failing with a ThrottledError
+// when the bucket of the request host is empty
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+
+	t.m.Lock()
+	bucket, ok := t.buckets[host]
+	if !ok {
+		bucket = NewBucketWithClock(t.max, t.refill, t.d, t.clock)
+		t.buckets[host] = bucket
+	}
+	t.m.Unlock()
+
+	if delay, ok := bucket.Take(); !ok {
+		// the RoundTripper owns the request body, even when not sending it
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, &ThrottledError{Host: host, Delay: delay}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// Handler wraps an http.Handler to limit the rate of incoming requests, using
+// a bucket of max tokens refilled by refill tokens every d.
+//
+// Throttled requests get a 429 Too Many Requests response, with a Retry-After
+// header when the time left before the next refill is known
+func Handler(next http.Handler, max uint, refill uint, d time.Duration) http.Handler {
+	return HandlerWithClock(next, max, refill, d, clock.Real())
+}
+
+// HandlerWithClock is like Handler, but refills the bucket according to the given Clock
+func HandlerWithClock(next http.Handler, max uint, refill uint, d time.Duration, clk clock.Clock) http.Handler {
+	bucket := NewBucketWithClock(max, refill, d, clk)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		delay, ok := bucket.Take()
+		if !ok {
+			if delay > 0 {
+				// Retry-After is given in whole seconds
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+			}
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
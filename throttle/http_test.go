@@ -0,0 +1,92 @@
+package throttle
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"patterns/clock"
+)
+
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func TestTransport(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	first := httptest.NewServer(http.HandlerFunc(okHandler))
+	defer first.Close()
+	second := httptest.NewServer(http.HandlerFunc(okHandler))
+	defer second.Close()
+
+	client := &http.Client{Transport: NewTransportWithClock(nil, 2, 1, time.Minute, clk)}
+
+	tests := []struct {
+		name    string
+		url     string
+		advance time.Duration
+		delay   time.Duration
+	}{
+		{"first token", first.URL, 0, 0},
+		{"second token", first.URL, 0, 0},
+		{"empty bucket", first.URL, 15 * time.Second, 45 * time.Second},
+		{"other hosts have their own bucket", second.URL, 0, 0},
+		{"refilled token", first.URL, 45 * time.Second, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.advance)
+			resp, err := client.Get(tt.url)
+			if tt.delay == 0 {
+				if err != nil {
+					t.Fatalf("Expected no error - got '%s'", err)
+				}
+				resp.Body.Close()
+				return
+			}
+
+			var throttled *ThrottledError
+			if !errors.As(err, &throttled) || !errors.Is(err, ErrThrottled) {
+				t.Fatalf("Expected error '%s' - got '%v'", ErrThrottled, err)
+			}
+			if throttled.RetryAfter() != tt.delay {
+				t.Errorf("Expected a %v delay - got %v", tt.delay, throttled.RetryAfter())
+			}
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	h := HandlerWithClock(http.HandlerFunc(okHandler), 1, 1, 90*time.Second, clk)
+
+	tests := []struct {
+		name       string
+		advance    time.Duration
+		status     int
+		retryAfter string
+	}{
+		{"first token", 0, http.StatusOK, ""},
+		{"empty bucket", 0, http.StatusTooManyRequests, "90"},
+		{"retry after rounds up", 29500 * time.Millisecond, http.StatusTooManyRequests, "61"},
+		{"refilled token", 60500 * time.Millisecond, http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.advance)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if w.Code != tt.status {
+				t.Errorf("Expected status %d - got %d", tt.status, w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Expected Retry-After '%s' - got '%s'", tt.retryAfter, got)
+			}
+		})
+	}
+}
@@ -5,56 +5,102 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"patterns/clock"
+	"patterns/stability"
 )
 
-var errThrottling = errors.New("too many calls")
+// ErrThrottled is matched, through errors.Is, by every error returned
+// when a call is throttled
+var ErrThrottled = errors.New("too many calls")
 
 // Effector is a function interacting with a service
-type Effector func(context.Context) (string, error)
+type Effector[T any] = stability.Effector[T]
 
 // Throttle wraps an Effector function to provide rate-limiting logic.
 //
 // It uses the token bucket strategy: a function call consumes one (or more) token from the bucket,
 // which then refills at a fixed rate.
 // When there are not enough tokens left, a custom throttling strategy is applied
-func Throttle(e Effector, max uint, refill uint, d time.Duration) Effector {
-	// token bucket
-	var tokens = max
-	var once sync.Once
+func Throttle[T any](e Effector[T], max uint, refill uint, d time.Duration) Effector[T] {
+	return ThrottleWithClock(e, max, refill, d, clock.Real())
+}
+
+// ThrottleWithClock is like Throttle, but refills the bucket according to the given Clock
+func ThrottleWithClock[T any](e Effector[T], max uint, refill uint, d time.Duration, clk clock.Clock) Effector[T] {
+	bucket := NewBucketWithClock(max, refill, d, clk)
 
-	return func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (T, error) {
+		var zero T
 		if ctx.Err() != nil {
-			return "", ctx.Err()
+			return zero, ctx.Err()
 		}
 
-		once.Do(func() {
-			ticker := time.NewTicker(d)
-
-			go func() {
-				defer ticker.Stop()
-
-				for {
-					select {
-					case <-ctx.Done():
-						return
-					// bucket refill
-					case <-ticker.C:
-						t := tokens + refill
-						if t > max {
-							t = max
-						}
-						tokens = t
-					}
-				}
-			}()
-		})
 		// can also return the results of the last function call
 		// or use a queue to retry calls later
-		if tokens <= 0 {
-			return "", errThrottling
+		if _, ok := bucket.Take(); !ok {
+			return zero, ErrThrottled
 		}
-		tokens--
 
 		return e(ctx)
 	}
 }
+
+// Bucket is a token bucket holding up to max tokens, refilled by refill tokens every d.
+// It can be shared by several callers, such as every request to the same host.
+//
+// The bucket is refilled lazily: every call adds the tokens accumulated
+// since the last refill, so no goroutine is needed to keep it up to date
+type Bucket struct {
+	max    uint
+	refill uint
+	d      time.Duration
+	clock  clock.Clock
+
+	m      sync.Mutex
+	tokens uint
+	last   time.Time
+}
+
+// NewBucket creates a full Bucket
+func NewBucket(max uint, refill uint, d time.Duration) *Bucket {
+	return NewBucketWithClock(max, refill, d, clock.Real())
+}
+
+// NewBucketWithClock is like NewBucket, but refills the bucket according to the given Clock
+func NewBucketWithClock(max uint, refill uint, d time.Duration, clk clock.Clock) *Bucket {
+	return &Bucket{max: max, refill: refill, d: d, clock: clk, tokens: max}
+}
+
+// Take consumes a token, reporting false if the bucket is empty. In that case,
+// it also returns the time left before the next refill, or zero if the bucket is never refilled
+func (b *Bucket) Take() (time.Duration, bool) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	now := b.clock.Now()
+	// the refill period starts with the first call
+	if b.last.IsZero() {
+		b.last = now
+	}
+
+	// bucket refill
+	if periods := now.Sub(b.last) / b.d; periods > 0 {
+		// compare before multiplying, to avoid overflows after long pauses
+		if missing := b.max - b.tokens; b.refill > 0 && uint(periods) > missing/b.refill {
+			b.tokens = b.max
+		} else {
+			b.tokens += uint(periods) * b.refill
+		}
+		b.last = b.last.Add(periods * b.d)
+	}
+
+	if b.tokens == 0 {
+		if b.refill == 0 || b.max == 0 {
+			return 0, false
+		}
+		return b.last.Add(b.d).Sub(now), false
+	}
+	b.tokens--
+	return 0, true
+}
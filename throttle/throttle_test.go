@@ -4,6 +4,8 @@ import (
 	"context"
 	"testing"
 	"time"
+
+	"patterns/clock"
 )
 
 func myEffector(ctx context.Context) (string, error) {
@@ -21,8 +23,8 @@ func TestThrottle(t *testing.T) {
 		err      error
 	}{
 		{"No throttling applied", 3, 1, 1 * time.Second, 2, "OK", nil},
-		{"No bucket equals instant throttling", 0, 1, 1 * time.Second, 1, "", errThrottling},
-		{"Too many calls", 2, 1, 1 * time.Second, 6, "", errThrottling},
+		{"No bucket equals instant throttling", 0, 1, 1 * time.Second, 1, "", ErrThrottled},
+		{"Too many calls", 2, 1, 1 * time.Second, 6, "", ErrThrottled},
 		{"Refill prevents throttling", 3, 1, 1 * time.Second, 4, "OK", nil},
 		{"Context deadline", 10, 1, 1 * time.Second, 15, "", context.DeadlineExceeded},
 	}
@@ -48,3 +50,33 @@ func TestThrottle(t *testing.T) {
 		})
 	}
 }
+
+func TestThrottleWithClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	e := ThrottleWithClock(myEffector, 2, 1, time.Minute, clk)
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		err     error
+	}{
+		{"first token", 0, nil},
+		{"second token", 0, nil},
+		{"empty bucket", 59 * time.Second, ErrThrottled},
+		{"refilled token", time.Second, nil},
+		{"empty bucket again", 0, ErrThrottled},
+		{"bucket refills up to max", time.Hour, nil},
+		{"second token after long pause", 0, nil},
+		{"empty bucket after long pause", 0, ErrThrottled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk.Advance(tt.advance)
+			if _, err := e(ctx); err != tt.err {
+				t.Errorf("Expected error '%v' - got '%v'", tt.err, err)
+			}
+		})
+	}
+}
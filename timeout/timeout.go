@@ -1,18 +1,28 @@
 package timeout
 
-import "context"
+import (
+	"context"
+	"time"
+
+	"patterns/clock"
+	"patterns/stability"
+)
+
+// Effector is a function interacting with a service
+type Effector[T any] = stability.Effector[T]
 
 // SlowFunction represents a function call which may, or may not, complete
 // in a reasonable amount of time
-type SlowFunction func(string) (string, error)
+type SlowFunction[A, R any] func(A) (R, error)
 
-type WithContext func(context.Context, string) (string, error)
+// WithContext represents a SlowFunction which also accepts a context
+type WithContext[A, R any] func(context.Context, A) (R, error)
 
 // Timeout wraps a SlowFunction to provide it a context, allowing
 // to run it in a separate goroutine for a maximum set amount of time
-func Timeout(f SlowFunction) WithContext {
-	return func(ctx context.Context, arg string) (string, error) {
-		chres := make(chan string)
+func Timeout[A, R any](f SlowFunction[A, R]) WithContext[A, R] {
+	return func(ctx context.Context, arg A) (R, error) {
+		chres := make(chan R)
 		cherr := make(chan error)
 
 		// run the slow function in its own goroutine
@@ -27,7 +37,43 @@ func Timeout(f SlowFunction) WithContext {
 			return res, <-cherr
 		// running for too long
 		case <-ctx.Done():
-			return "", ctx.Err()
+			var zero R
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// Limit wraps an Effector so that every call is given at most d to complete.
+//
+// The Effector receives a context expiring after d and runs in its own goroutine,
+// so that the call returns on time even if the Effector ignores its context
+func Limit[T any](e Effector[T], d time.Duration) Effector[T] {
+	return LimitWithClock(e, d, clock.Real())
+}
+
+// LimitWithClock is like Limit, but measures d using the given Clock
+func LimitWithClock[T any](e Effector[T], d time.Duration, clk clock.Clock) Effector[T] {
+	return func(ctx context.Context) (T, error) {
+		ctx, cancel := clk.WithTimeout(ctx, d)
+		defer cancel()
+
+		// buffered, so that a late Effector does not leak its goroutine
+		chres := make(chan T, 1)
+		cherr := make(chan error, 1)
+
+		go func() {
+			res, err := e(ctx)
+			chres <- res
+			cherr <- err
+		}()
+
+		select {
+		case res := <-chres:
+			return res, <-cherr
+		case <-ctx.Done():
+			var zero T
+			// tells a timeout apart from a cancellation, whatever the Clock
+			return zero, context.Cause(ctx)
 		}
 	}
 }
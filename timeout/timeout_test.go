@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"testing"
 	"time"
+
+	"patterns/clock"
 )
 
 func mySlowFunc(in string) (string, error) {
@@ -39,3 +41,57 @@ func TestTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limit    time.Duration
+		expected string
+		err      error
+	}{
+		{"Effector responds in time", 200 * time.Millisecond, "OK", nil},
+		{"Effector takes too long", 50 * time.Millisecond, "", context.DeadlineExceeded},
+	}
+
+	// ignores its context on purpose
+	slowEffector := func(ctx context.Context) (string, error) {
+		time.Sleep(100 * time.Millisecond)
+		return "OK", nil
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Limit(slowEffector, tt.limit)
+			res, err := e(context.Background())
+
+			if err != tt.err {
+				t.Errorf("Expected error '%v' - got '%v'", tt.err, err)
+			} else if res != tt.expected {
+				t.Errorf("Expected res to be '%s' - got '%s'", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestLimitWithClock(t *testing.T) {
+	clk := clock.NewFake(time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC))
+	release := make(chan struct{})
+	defer close(release)
+
+	e := LimitWithClock(func(ctx context.Context) (string, error) {
+		<-release
+		return "OK", nil
+	}, time.Minute, clk)
+
+	done := make(chan error)
+	go func() {
+		_, err := e(context.Background())
+		done <- err
+	}()
+
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	if err := <-done; err != context.DeadlineExceeded {
+		t.Errorf("Expected error '%v' - got '%v'", context.DeadlineExceeded, err)
+	}
+}